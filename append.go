@@ -7,6 +7,12 @@ import (
 
 // Write encoded value into output stream.
 func Write(out io.Writer, value interface{}) error {
+	return WriteWithOptions(out, value, nil)
+}
+
+// WriteWithOptions writes encoded value into output stream. Boolean values without `bool` tag are written using the
+// first pair of params.BoolSpellings, so the output could be parsed with the same options. Other options are ignored.
+func WriteWithOptions(out io.Writer, value interface{}, params *Options) error {
 	valueOf := reflect.ValueOf(value)
 	typeOf := valueOf.Type()
 
@@ -15,7 +21,15 @@ func Write(out io.Writer, value interface{}) error {
 		return err
 	}
 
-	return p.WriteValue(out, valueOf)
+	w := &indentWriter{out: out}
+	if params != nil && params.BoolSpellings != "" {
+		w.bools, err = parseBoolPairs(params.BoolSpellings)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.WriteValue(w, valueOf)
 }
 
 type appender struct {
@@ -30,8 +44,14 @@ func (a *appender) Write(data []byte) (int, error) {
 // Append encoded value to slice.
 // Function returns new slice.
 func Append(array []byte, value interface{}) ([]byte, error) {
+	return AppendWithOptions(array, value, nil)
+}
+
+// AppendWithOptions appends encoded value to slice using options of writing (see WriteWithOptions).
+// Function returns new slice.
+func AppendWithOptions(array []byte, value interface{}, params *Options) ([]byte, error) {
 	x := &appender{array}
-	err := Write(x, value)
+	err := WriteWithOptions(x, value, params)
 	if err != nil {
 		return nil, err
 	}
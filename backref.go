@@ -0,0 +1,118 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Parser of string fields with `match` or `until` tag. Value of these fields depends on value of another field
+// of the same structure parsed before (heredoc terminators, names of XML tags), so they are parsed by the field
+// itself without packrat table.
+type backrefParser struct {
+	idHolder
+	terminal
+	// Name of referenced field
+	Field string
+	// Parse text until the value of referenced field instead of the value itself
+	Until bool
+}
+
+// Set `match` or `until` reference of the field. Referenced field must be named string field declared before.
+func setBackrefField(typeOf reflect.Type, fld *field, idx int, tag reflect.StructTag) (bool, error) {
+	match, hasMatch := tag.Lookup("match")
+	until, hasUntil := tag.Lookup("until")
+	if !hasMatch && !hasUntil {
+		return false, nil
+	}
+
+	if hasMatch && hasUntil {
+		return false, fmt.Errorf("Field `%v.%s' has both match and until tags", typeOf, fld.Name)
+	}
+
+	if fld.Type.Kind() != reflect.String {
+		return false, fmt.Errorf("Invalid type of `%v.%s': match and until tags could be used only with strings", typeOf, fld.Name)
+	}
+
+	name := match
+	if hasUntil {
+		if fld.Index < 0 {
+			return false, fmt.Errorf("Can't use until tag with anonymous field in `%v'", typeOf)
+		}
+		name = until
+	}
+
+	ref, ok := typeOf.FieldByName(name)
+	if !ok || name == "_" || len(ref.Index) != 1 || ref.Type.Kind() != reflect.String {
+		return false, fmt.Errorf("Invalid referenced field `%s' for `%v.%s'", name, typeOf, fld.Name)
+	}
+
+	if ref.Index[0] >= idx {
+		return false, fmt.Errorf("Referenced field `%s' must be declared before `%v.%s'", name, typeOf, fld.Name)
+	}
+
+	p := &backrefParser{Field: name, Until: hasUntil}
+	if hasUntil {
+		registerParser(p, fmt.Sprintf("%v `until:%q`", fld.Type, name))
+	} else {
+		registerParser(p, fmt.Sprintf("%v `match:%q`", fld.Type, name))
+	}
+
+	fld.Parse = p
+	fld.Flags |= fieldBackref
+	fld.Ref = ref.Index[0]
+
+	return true, nil
+}
+
+func (par *backrefParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	panic(fmt.Sprintf("Back reference to `%s' could be parsed only as a field", par.Field))
+}
+
+// Parse value depending on ref: value of referenced field.
+func (par *backrefParser) parseRef(ctx *parseContext, valueOf reflect.Value, ref string, location int, err *Error) int {
+	if par.Until {
+		i := bytes.Index(ctx.str[location:], []byte(ref))
+		if i < 0 {
+			err.Location = location
+			err.Message = fmt.Sprintf("Waiting for `%s'", ref)
+			return -1
+		}
+
+		valueOf.SetString(string(ctx.str[location : location+i]))
+		return location + i
+	}
+
+	if !strAt(ctx.str, location, ref) {
+		err.Location = location
+		err.Message = fmt.Sprintf("Waiting for `%s'", ref)
+		return -1
+	}
+
+	valueOf.SetString(ref)
+	return location + len(ref)
+}
+
+func (par *backrefParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	panic(fmt.Sprintf("Back reference to `%s' could be written only as a field", par.Field))
+}
+
+// Write value of the field (or referenced value for match).
+func (par *backrefParser) writeRef(out io.Writer, valueOf reflect.Value, ref string) error {
+	s := ref
+	if par.Until {
+		s = valueOf.String()
+		if ref != "" && strings.Contains(s, ref) {
+			return fmt.Errorf("Value `%s' contains terminator `%s'", s, ref)
+		}
+	}
+
+	_, err := out.Write([]byte(s))
+	return err
+}
+
+func (par *backrefParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, true
+}
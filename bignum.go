@@ -0,0 +1,129 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+// Parsers for arbitrary-precision numbers from math/big. Fields are usually of pointer types (*big.Int, *big.Float
+// and *big.Rat) and values are allocated while parsing.
+
+var _bigIntType = reflect.TypeOf(big.Int{})
+var _bigFloatType = reflect.TypeOf(big.Float{})
+var _bigRatType = reflect.TypeOf(big.Rat{})
+
+var bigIntRegexp = regexp.MustCompile(`^[-+]?(0[xX][0-9a-fA-F_]+|0[bB][01_]+|0[oO][0-7_]+|[0-9][0-9_]*)`)
+var bigFloatRegexp = regexp.MustCompile(`^[-+]?(0[xX][0-9a-fA-F_]+|0[bB][01_]+|0[oO][0-7_]+|([0-9][0-9_]*(\.[0-9_]*)?|\.[0-9][0-9_]*)([eE][-+]?[0-9_]+)?)`)
+var bigRatRegexp = regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?(/[0-9]+)?`)
+
+// Kinds of big numbers
+const (
+	bigInt = iota
+	bigFloat
+	bigRat
+)
+
+type bigParser struct {
+	idHolder
+	terminal
+	Kind int
+	// Precision of big.Float in bits (0 means default precision)
+	Prec uint
+}
+
+func compileBig(typeOf reflect.Type, tag reflect.StructTag) (parser, error) {
+	switch typeOf {
+	case _bigIntType:
+		return &bigParser{Kind: bigInt}, nil
+	case _bigRatType:
+		return &bigParser{Kind: bigRat}, nil
+	}
+
+	res := &bigParser{Kind: bigFloat}
+	if s := tag.Get("precision"); s != "" {
+		prec, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid precision `%s' of %v", s, typeOf)
+		}
+
+		res.Prec = uint(prec)
+	}
+
+	return res, nil
+}
+
+func (par *bigParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	var m []byte
+	var v interface{}
+	ok := false
+
+	switch par.Kind {
+	case bigInt:
+		m = bigIntRegexp.Find(ctx.str[location:])
+		if m != nil {
+			var x *big.Int
+			x, ok = new(big.Int).SetString(string(m), 0)
+			v = x
+		}
+	case bigFloat:
+		m = bigFloatRegexp.Find(ctx.str[location:])
+		if m != nil {
+			x := new(big.Float).SetPrec(par.Prec)
+			_, _, e := x.Parse(string(m), 0)
+			ok = e == nil
+			v = x
+		}
+	default:
+		m = bigRatRegexp.Find(ctx.str[location:])
+		if m != nil {
+			var x *big.Rat
+			x, ok = new(big.Rat).SetString(string(m))
+			v = x
+		}
+	}
+
+	if m == nil {
+		err.Location = location
+		err.Message = "Waiting for number"
+		return -1
+	}
+
+	if !ok {
+		err.Location = location
+		err.Message = fmt.Sprintf("Invalid number `%s'", string(m))
+		return -1
+	}
+
+	valueOf.Set(reflect.ValueOf(v).Elem())
+
+	return location + len(m)
+}
+
+func (par *bigParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	if !valueOf.CanAddr() {
+		tmp := reflect.New(valueOf.Type())
+		tmp.Elem().Set(valueOf)
+		valueOf = tmp.Elem()
+	}
+
+	var s string
+	switch x := valueOf.Addr().Interface().(type) {
+	case *big.Int:
+		s = x.String()
+	case *big.Float:
+		s = x.Text('g', -1)
+	case *big.Rat:
+		s = x.RatString()
+	}
+
+	_, err := out.Write([]byte(s))
+	return err
+}
+
+func (par *bigParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, false
+}
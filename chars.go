@@ -0,0 +1,257 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Set of characters defined by `chars` and `unicode` tags.
+type charClass struct {
+	// ASCII characters bitmap
+	ascii [2]uint64
+	// Ranges of non-ASCII characters: pairs of first and last characters
+	ranges []rune
+	// Unicode categories and scripts
+	tables []*unicode.RangeTable
+	negate bool
+	// Readable description of the class for error messages
+	desc string
+}
+
+func (c *charClass) addRange(from, to rune) {
+	for r := from; r <= to && r < utf8.RuneSelf; r++ {
+		c.ascii[r/64] |= 1 << uint(r%64)
+	}
+
+	if to >= utf8.RuneSelf {
+		if from < utf8.RuneSelf {
+			from = utf8.RuneSelf
+		}
+		c.ranges = append(c.ranges, from, to)
+	}
+}
+
+// Check if character is in the class.
+func (c *charClass) match(r rune) bool {
+	res := false
+	if r >= 0 && r < utf8.RuneSelf {
+		res = (c.ascii[r/64] & (1 << uint(r%64))) != 0
+	} else {
+		for i := 0; i < len(c.ranges); i += 2 {
+			if r >= c.ranges[i] && r <= c.ranges[i+1] {
+				res = true
+				break
+			}
+		}
+	}
+
+	if !res && len(c.tables) > 0 {
+		res = unicode.IsOneOf(c.tables, r)
+	}
+
+	return res != c.negate
+}
+
+// Get next character of the chars tag.
+func nextClassChar(spec string) (rune, string, error) {
+	r, l := utf8.DecodeRuneInString(spec)
+	if r != '\\' {
+		return r, spec[l:], nil
+	}
+
+	if len(spec) < 2 {
+		return 0, "", fmt.Errorf("Invalid escape at the end of chars tag")
+	}
+
+	switch spec[1] {
+	case 'n':
+		return '\n', spec[2:], nil
+	case 't':
+		return '\t', spec[2:], nil
+	case 'r':
+		return '\r', spec[2:], nil
+	}
+
+	r, l = utf8.DecodeRuneInString(spec[1:])
+	return r, spec[1+l:], nil
+}
+
+// Compile character class from `chars` and `unicode` tags. Chars tag has the syntax of regular expression
+// character class without brackets: "a-zA-Z_", "^0-9". Unicode tag is comma separated list of Unicode
+// categories or scripts: "L,Nd". If both tags are set class contains characters matching any of them.
+// Returns nil if there are no such tags.
+func compileCharClass(tag reflect.StructTag) (*charClass, error) {
+	chars, hasChars := tag.Lookup("chars")
+	names, hasUnicode := tag.Lookup("unicode")
+	if !hasChars && !hasUnicode {
+		return nil, nil
+	}
+
+	res := &charClass{}
+	var desc []string
+
+	if hasChars {
+		spec := chars
+		if strings.HasPrefix(spec, "^") {
+			res.negate = true
+			spec = spec[1:]
+		}
+
+		if spec == "" {
+			return nil, fmt.Errorf("Empty chars tag")
+		}
+
+		for spec != "" {
+			from, rest, err := nextClassChar(spec)
+			if err != nil {
+				return nil, err
+			}
+
+			to := from
+			if len(rest) > 1 && rest[0] == '-' {
+				to, rest, err = nextClassChar(rest[1:])
+				if err != nil {
+					return nil, err
+				}
+
+				if to < from {
+					return nil, fmt.Errorf("Invalid range %q in chars tag", string([]rune{from, '-', to}))
+				}
+			}
+
+			res.addRange(from, to)
+			spec = rest
+		}
+
+		desc = append(desc, "["+chars+"]")
+	}
+
+	if hasUnicode {
+		if res.negate {
+			return nil, fmt.Errorf("Negated chars tag could not be used with unicode tag")
+		}
+
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			table, ok := unicode.Categories[name]
+			if !ok {
+				table, ok = unicode.Scripts[name]
+			}
+
+			if !ok {
+				return nil, fmt.Errorf("Unknown Unicode category or script `%s'", name)
+			}
+
+			res.tables = append(res.tables, table)
+		}
+
+		desc = append(desc, "Unicode "+names)
+	}
+
+	res.desc = strings.Join(desc, " or ")
+
+	return res, nil
+}
+
+// Parser of strings or runes consisting of characters from the class.
+type charsParser struct {
+	idHolder
+	terminal
+	Class *charClass
+	// Minimal and maximal count of characters (0 means unlimited)
+	Min int
+	Max int
+}
+
+func compileChars(typeOf reflect.Type, tag reflect.StructTag, class *charClass) (parser, error) {
+	res := &charsParser{Class: class, Min: 1, Max: 0}
+	if typeOf.Kind() == reflect.Int32 {
+		res.Max = 1
+		return res, nil
+	}
+
+	for _, t := range []struct {
+		name string
+		v    *int
+	}{{"min", &res.Min}, {"max", &res.Max}} {
+		if s := tag.Get(t.name); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("Invalid %s tag value `%s'", t.name, s)
+			}
+			*t.v = v
+		}
+	}
+
+	if res.Max > 0 && res.Max < res.Min {
+		return nil, fmt.Errorf("Invalid count of characters: min = %d > max = %d", res.Min, res.Max)
+	}
+
+	return res, nil
+}
+
+func (par *charsParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	l := location
+	cnt := 0
+	for l < len(ctx.str) && (par.Max == 0 || cnt < par.Max) {
+		r, size := utf8.DecodeRune(ctx.str[l:])
+		if !par.Class.match(r) {
+			break
+		}
+
+		l += size
+		cnt++
+	}
+
+	if cnt < par.Min {
+		err.Location = l
+		if par.Min == 1 {
+			err.Message = fmt.Sprintf("Waiting for character of %s", par.Class.desc)
+		} else {
+			err.Message = fmt.Sprintf("Waiting for at least %d characters of %s", par.Min, par.Class.desc)
+		}
+		return -1
+	}
+
+	if valueOf.Kind() == reflect.Int32 {
+		r, _ := utf8.DecodeRune(ctx.str[location:l])
+		valueOf.SetInt(int64(r))
+	} else {
+		valueOf.SetString(string(ctx.str[location:l]))
+	}
+
+	return l
+}
+
+func (par *charsParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	var s string
+	if valueOf.Kind() == reflect.Int32 {
+		s = string(rune(valueOf.Int()))
+	} else {
+		s = valueOf.String()
+	}
+
+	cnt := 0
+	for _, r := range s {
+		if !par.Class.match(r) {
+			return fmt.Errorf("Character %q is not in %s", r, par.Class.desc)
+		}
+		cnt++
+	}
+
+	if cnt < par.Min || (par.Max > 0 && cnt > par.Max) {
+		return fmt.Errorf("Invalid count of characters in `%s'", s)
+	}
+
+	_, err := out.Write([]byte(s))
+	return err
+}
+
+func (par *charsParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, par.Min == 0
+}
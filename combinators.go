@@ -0,0 +1,45 @@
+package parse
+
+import "reflect"
+
+// Generic wrappers for common grammar constructions. They compile to the same parsers as tags
+// and could be nested freely: Opt[SepBy[Many1[Word], Comma]].
+
+// And is positive lookahead: T must be present at the current location but it is not consumed.
+// Parsed value is saved into Value. And is not written by Write.
+type And[T any] struct {
+	Value T `parse:"&"`
+}
+
+// Not is negative lookahead: T must not be present at the current location. Nothing is consumed.
+type Not[T any] struct {
+	_ T `parse:"!"`
+}
+
+// Opt is optional T. Value is nil if T is not present.
+type Opt[T any] struct {
+	Value *T `parse:"?"`
+}
+
+// Many is zero or more T.
+type Many[T any] []T
+
+// Many1 is one or more T.
+type Many1[T any] []T
+
+func (Many1[T]) repeatMin() int {
+	return 1
+}
+
+// Slice types with minimal count of elements.
+type repeatMin interface {
+	repeatMin() int
+}
+
+var _repeatMinType = reflect.TypeOf((*repeatMin)(nil)).Elem()
+
+// SepBy is list of T separated by Sep. Parsed separators are saved into Seps and used by Write.
+type SepBy[T any, Sep any] struct {
+	Items []T `delimiters:"Seps"`
+	Seps  []Sep
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"sync"
 	"unicode"
 	"unicode/utf8"
@@ -111,7 +114,28 @@ func appendField(typeOf reflect.Type, fields *[]field, idx int) error {
 		return nil
 	}
 
+	if fType.Type == _tokenType && fType.Anonymous {
+		// Token marker
+		return nil
+	}
+
 	fld := field{Name: fType.Name, Type: fType.Type}
+
+	if fType.Anonymous {
+		p, err := compileInline(fType)
+		if err != nil {
+			return err
+		}
+
+		if p != nil {
+			fld.Index = idx
+			fld.Parse = p
+			fld.Flags |= fieldInline
+			*fields = append(*fields, fld)
+			return nil
+		}
+	}
+
 	if fType.Name != "_" {
 		r, l := utf8.DecodeRuneInString(fType.Name)
 		if l == 0 || !unicode.IsUpper(r) { // Private field: skipping
@@ -130,19 +154,188 @@ func appendField(typeOf reflect.Type, fields *[]field, idx int) error {
 	}
 
 	fld.Set = fType.Tag.Get("set")
+	fld.Check = fType.Tag.Get("check")
 
-	p, err := compileInternal(fType.Type, fType.Tag)
+	if prec := fType.Tag.Get("prec"); prec != "" {
+		v, err := strconv.Atoi(prec)
+		if err != nil {
+			return fmt.Errorf("Invalid precedence of `%v.%s': %s", typeOf, fType.Name, prec)
+		}
+
+		fld.Prec = v
+		fld.Flags |= fieldPrec
+	}
+
+	switch fType.Tag.Get("assoc") {
+	case "", "left":
+		fld.Assoc = AssocLeft
+	case "right":
+		fld.Assoc = AssocRight
+	case "none":
+		fld.Assoc = AssocNone
+	default:
+		return fmt.Errorf("Invalid associativity of `%v.%s': %s", typeOf, fType.Name, fType.Tag.Get("assoc"))
+	}
+
+	isRef, err := setBackrefField(typeOf, &fld, idx, fType.Tag)
 	if err != nil {
+		return err
+	}
+
+	if isRef {
+		*fields = append(*fields, fld)
 		return nil
 	}
 
+	p, err := compileInternal(fType.Type, fType.Tag)
+	if err != nil {
+		return err
+	}
+
 	fld.Parse = p
 
+	if name := fType.Tag.Get("delimiters"); name != "" {
+		err = setDelimitersField(typeOf, &fld, name)
+		if err != nil {
+			return err
+		}
+	}
+
 	*fields = append(*fields, fld)
 
 	return nil
 }
 
+// Compile parser for embedded field if it must be inlined into the parent structure. Embedded structures
+// (and pointers to structures for optional groups) are inlined if they are parsed as sequences or FirstOf.
+// Returns nil if field is not inlined.
+func compileInline(fType reflect.StructField) (parser, error) {
+	typeOf := fType.Type
+	if typeOf.Kind() == reflect.Ptr {
+		r, _ := utf8.DecodeRuneInString(fType.Name)
+		if !unicode.IsUpper(r) {
+			// We can't allocate value of private field
+			return nil, nil
+		}
+
+		typeOf = typeOf.Elem()
+	}
+
+	if typeOf.Kind() != reflect.Struct || typeOf == _tokenType || typeOf == _firstOfType {
+		return nil, nil
+	}
+
+	p, err := compileInternal(typeOf, fType.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	inner := p
+	if proxy, ok := p.(*proxyParser); ok {
+		// Recursive type is not compiled yet
+		inner = proxy.p
+	}
+
+	switch inner.(type) {
+	case *sequenceParser, *firstOfParser:
+		return p, nil
+	}
+
+	return nil, nil
+}
+
+// Configure field to save delimiters of the list into the field with specified name.
+func setDelimitersField(typeOf reflect.Type, fld *field, name string) error {
+	dField, ok := typeOf.FieldByName(name)
+	if !ok || len(dField.Index) != 1 || dField.Type.Kind() != reflect.Slice {
+		return fmt.Errorf("Invalid delimiters field `%s' for `%v.%s'", name, typeOf, fld.Name)
+	}
+
+	if fld.Index < 0 {
+		return fmt.Errorf("Can't save delimiters of anonymous field in `%v'", typeOf)
+	}
+
+	lst, ok := fld.Parse.(listParser)
+	if !ok {
+		return fmt.Errorf("Field `%v.%s' is not a list or map", typeOf, fld.Name)
+	}
+
+	if lst.delimiter().Delimiter == nil {
+		// Delimiter is defined by type of the field:
+		p, err := compileInternal(dField.Type.Elem(), "")
+		if err != nil {
+			return err
+		}
+
+		switch l := lst.(type) {
+		case *sliceParser:
+			tmp := *l
+			lst = &tmp
+		case *mapParser:
+			tmp := *l
+			lst = &tmp
+		}
+
+		lst.delimiter().Delimiter = p
+		lst.delimiter().DelimType = dField.Type.Elem()
+		registerParser(lst, fmt.Sprintf("%v `delimiters:%q`", fld.Type, name))
+	}
+
+	if lst.delimiter().DelimType != dField.Type.Elem() {
+		return fmt.Errorf("Invalid type of delimiters field `%v.%s': waiting for []%v", typeOf, name, lst.delimiter().DelimType)
+	}
+
+	fld.Parse = lst
+	fld.Flags |= fieldDelimiters
+	fld.Delimiters = dField.Index[0]
+
+	return nil
+}
+
+// Get sorted list of precedence levels of alternatives.
+func precLevels(fields []field) []int {
+	var levels []int
+	for _, f := range fields {
+		if (f.Flags & fieldPrec) != 0 {
+			levels = append(levels, f.Prec)
+		}
+	}
+
+	sort.Ints(levels)
+
+	res := levels[:0]
+	for i, l := range levels {
+		if i == 0 || l != levels[i-1] {
+			res = append(res, l)
+		}
+	}
+
+	return res
+}
+
+// Remove fields used to save delimiters from the list of parsed fields.
+func removeDelimitersFields(fields []field) []field {
+	used := make(map[int]bool)
+	for _, f := range fields {
+		if (f.Flags & fieldDelimiters) != 0 {
+			used[f.Delimiters] = true
+		}
+	}
+
+	if len(used) == 0 {
+		return fields
+	}
+
+	res := make([]field, 0, len(fields))
+	for _, f := range fields {
+		if f.Index < 0 || !used[f.Index] {
+			res = append(res, f)
+		}
+	}
+
+	return res
+}
+
 // Type and tag for parse keys
 type typeAndTag struct {
 	Type reflect.Type
@@ -154,6 +347,61 @@ var _compiledParsers = make(map[typeAndTag]parser)
 var _lastID uint = 1
 var _compileMutex sync.Mutex
 
+// Types registered by name to use them in tags.
+var _registeredTypes = make(map[string]reflect.Type)
+
+// RegisterType registers type of value with name. Registered types could be used in tags,
+// for example `delimiterType:"name"`. Types must be registered before the first parsing of the types using them.
+func RegisterType(name string, value interface{}) {
+	_compileMutex.Lock()
+	defer _compileMutex.Unlock()
+
+	_registeredTypes[name] = reflect.TypeOf(value)
+}
+
+// Registered implementations of interface types.
+var _alternatives = make(map[reflect.Type][]reflect.Type)
+
+// RegisterAlternatives registers implementations of interface type I. Fields of type I will be parsed by trying
+// types of alternatives in the order of registration. First successfully parsed value is stored into the field.
+// Alternatives must be registered before the first parsing of the types using them.
+//
+//	parse.RegisterAlternatives[Stmt](IfStmt{}, ForStmt{}, ExprStmt{})
+func RegisterAlternatives[I any](alts ...I) {
+	_compileMutex.Lock()
+	defer _compileMutex.Unlock()
+
+	typeOf := reflect.TypeOf((*I)(nil)).Elem()
+	for _, alt := range alts {
+		tp := reflect.TypeOf(alt)
+		if tp == nil {
+			panic("RegisterAlternatives: nil alternative")
+		}
+
+		_alternatives[typeOf] = append(_alternatives[typeOf], tp)
+	}
+}
+
+// Compile parser for interface type with registered alternatives.
+func compileInterface(typeOf reflect.Type) (parser, error) {
+	alts, ok := _alternatives[typeOf]
+	if !ok {
+		return nil, fmt.Errorf("There are no registered alternatives for interface type '%v'", typeOf)
+	}
+
+	res := &interfaceParser{Types: alts}
+	for _, tp := range alts {
+		p, err := compileInternal(tp, "")
+		if err != nil {
+			return nil, err
+		}
+
+		res.Parsers = append(res.Parsers, p)
+	}
+
+	return res, nil
+}
+
 // Compile parser for type. Only one compilation process is possible in the same time.
 func compile(typeOf reflect.Type, tag reflect.StructTag) (parser, error) {
 	_compileMutex.Lock()
@@ -203,15 +451,144 @@ func compileInternal(typeOf reflect.Type, tag reflect.StructTag) (parser, error)
 }
 
 var _parserType = reflect.TypeOf((*Parser)(nil)).Elem()
+var _statefulParserType = reflect.TypeOf((*StatefulParser)(nil)).Elem()
+
+var _tokenType = reflect.TypeOf(Token{})
+
+// Remove key from the tag.
+func tagWithout(tag reflect.StructTag, key string) reflect.StructTag {
+	res := ""
+	for tag != "" {
+		// Skip leading space.
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+
+		// Scan to colon and quoted value (same syntax as in reflect.StructTag.Lookup).
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		name := string(tag[:i])
+
+		i++
+		for i++; i < len(tag) && tag[i] != '"'; i++ {
+			if tag[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(tag) {
+			break
+		}
+
+		if name != key {
+			if res != "" {
+				res += " "
+			}
+			res += string(tag[:i+1])
+		}
+		tag = tag[i+1:]
+	}
+
+	return reflect.StructTag(res)
+}
+
+// Set name and ID for parser that is not stored in the compiled parsers table.
+func registerParser(p parser, name string) {
+	p.SetString(name)
+	p.SetID(_lastID)
+	_lastID++
+}
 
 func compileType(typeOf reflect.Type, tag reflect.StructTag) (p parser, err error) {
+	if names := tag.Get("skip"); names != "" {
+		skip, key, err := getSkipper(names)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := compileInternal(typeOf, tagWithout(tag, "skip"))
+		if err != nil {
+			return nil, err
+		}
+
+		return &skipParser{Parser: p, Skip: skip, Key: key}, nil
+	}
+
+	if tag.Get("parse") == "lexical" {
+		p, err := compileInternal(typeOf, tagWithout(tag, "parse"))
+		if err != nil {
+			return nil, err
+		}
+
+		return &skipParser{Parser: p, Skip: nil, Key: skipKeyLexical}, nil
+	}
+
+	if tag.Get("parse") == "raw" {
+		return compileRaw(typeOf, tag)
+	}
+
 	// Check if field has type that implements parser:
-	if typeOf.Implements(_parserType) {
+	if typeOf.Implements(_contextParserType) {
+		return &contextParser{ptr: false}, nil
+	} else if typeOf.Kind() != reflect.Ptr && reflect.PtrTo(typeOf).Implements(_contextParserType) {
+		return &contextParser{ptr: true}, nil
+	}
+
+	if typeOf.Implements(_parserType) || typeOf.Implements(_statefulParserType) {
 		return &parserParser{ptr: false}, nil
-	} else if typeOf.Kind() != reflect.Ptr && reflect.PtrTo(typeOf).Implements(_parserType) {
+	} else if typeOf.Kind() != reflect.Ptr && (reflect.PtrTo(typeOf).Implements(_parserType) ||
+		reflect.PtrTo(typeOf).Implements(_statefulParserType)) {
 		return &parserParser{ptr: true}, nil
 	}
 
+	switch typeOf {
+	case reflect.TypeOf(Newline{}):
+		return &newlineParser{}, nil
+	case reflect.TypeOf(EOL{}):
+		return &eolParser{}, nil
+	case reflect.TypeOf(Indent{}):
+		return &indentParser{}, nil
+	case reflect.TypeOf(Dedent{}):
+		return &dedentParser{}, nil
+	}
+
+	if typeOf == _bigIntType || typeOf == _bigFloatType || typeOf == _bigRatType {
+		return compileBig(typeOf, tag)
+	}
+
+	switch typeOf {
+	case _timeType:
+		return compileTime(tag)
+	case _durationType:
+		return &durationParser{}, nil
+	}
+
+	// Special types above have their own parsers even if they implement encoding.TextUnmarshaler:
+	if p, err := compileText(typeOf, tag); p != nil || err != nil {
+		return p, err
+	}
+
+	if typeOf.Implements(_binaryExprType) {
+		return compileExpr(typeOf)
+	}
+
+	if typeOf.Implements(_rawValueType) {
+		return compileRawWrapper(typeOf)
+	}
+
+	if p, err := compileEnum(typeOf, tag); p != nil || err != nil {
+		return p, err
+	}
+
 	switch typeOf.Kind() {
 	case reflect.Struct:
 		if typeOf.NumField() == 0 { // Empty
@@ -219,33 +596,72 @@ func compileType(typeOf reflect.Type, tag reflect.StructTag) (p parser, err erro
 		}
 
 		fields := []field{}
-		if typeOf.Field(0).Type == reflect.TypeOf(FirstOf{}) { // FirstOf
-			for i := 1; i < typeOf.NumField(); i++ {
+		lexical := false
+		for i := 0; i < typeOf.NumField(); i++ {
+			if typeOf.Field(i).Type == _tokenType && typeOf.Field(i).Anonymous {
+				lexical = true
+			}
+		}
+
+		firstOf := -1
+		for i := 0; i < typeOf.NumField(); i++ {
+			if typeOf.Field(i).Type == _firstOfType && typeOf.Field(i).Anonymous {
+				firstOf = i
+				break
+			}
+		}
+
+		if firstOf >= 0 { // FirstOf
+			for i := 0; i < typeOf.NumField(); i++ {
+				if i == firstOf {
+					continue
+				}
+
 				err = appendField(typeOf, &fields, i)
 				if err != nil {
 					return nil, err
 				}
 			}
 
-			return &firstOfParser{Fields: fields}, nil
-		}
-
-		for i := 0; i < typeOf.NumField(); i++ {
-			err = appendField(typeOf, &fields, i)
+			fields = removeDelimitersFields(fields)
+			p = &firstOfParser{Fields: fields, Levels: precLevels(fields)}
+		} else {
+			for i := 0; i < typeOf.NumField(); i++ {
+				err = appendField(typeOf, &fields, i)
 
-			if err != nil {
-				return nil, err
+				if err != nil {
+					return nil, err
+				}
 			}
+
+			p = &sequenceParser{Fields: removeDelimitersFields(fields)}
 		}
 
-		return &sequenceParser{Fields: fields}, nil
+		if lexical {
+			registerParser(p, fmt.Sprintf("%v `%v` (token)", typeOf, tag))
+			return &skipParser{Parser: p, Skip: nil, Key: skipKeyLexical}, nil
+		}
+
+		return p, nil
 
 	case reflect.String:
+		class, err := compileCharClass(tag)
+		if err != nil {
+			return nil, err
+		} else if class != nil {
+			return compileChars(typeOf, tag, class)
+		}
+
 		rx := tag.Get("regexp")
 		if rx == "" {
 			lit := tag.Get("literal")
 			if lit == "" {
-				return &stringParser{}, nil
+				d, err := compileStringDialect(tag)
+				if err != nil {
+					return nil, err
+				}
+
+				return &stringParser{Dialect: d}, nil
 			}
 
 			return newLiteralParser(lit), nil
@@ -259,18 +675,59 @@ func compileType(typeOf reflect.Type, tag reflect.StructTag) (p parser, err erro
 			return &locationParser{}, nil
 		}
 
-		return &intParser{}, nil
+		if typeOf.Kind() == reflect.Int32 {
+			class, err := compileCharClass(tag)
+			if err != nil {
+				return nil, err
+			} else if class != nil {
+				return compileChars(typeOf, tag, class)
+			}
+		}
+
+		d, err := compileNumberDialect(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		return &intParser{Dialect: d}, nil
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return &uintParser{}, nil
+		d, err := compileNumberDialect(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		return &uintParser{Dialect: d}, nil
 
 	case reflect.Bool:
+		if spec := tag.Get("bool"); spec != "" {
+			pairs, err := parseBoolPairs(spec)
+			if err != nil {
+				return nil, err
+			}
+
+			return &boolParser{Pairs: pairs}, nil
+		}
+
 		return &boolParser{}, nil
 
 	case reflect.Float32, reflect.Float64:
-		return &floatParser{}, nil
+		d, err := compileNumberDialect(tag)
+		if err != nil {
+			return nil, err
+		}
 
-	/* TODO: complex numbers */
+		return &floatParser{Dialect: d}, nil
+
+	case reflect.Complex64, reflect.Complex128:
+		switch tag.Get("complex") {
+		case "":
+			return &complexParser{}, nil
+		case "pair":
+			return &complexParser{Pair: true}, nil
+		default:
+			return nil, fmt.Errorf("Invalid complex tag value `%s'", tag.Get("complex"))
+		}
 
 	case reflect.Slice:
 		min := 0
@@ -282,14 +739,27 @@ func compileType(typeOf reflect.Type, tag reflect.StructTag) (p parser, err erro
 			min = 1
 		}
 
-		delimiter := tag.Get("delimiter")
+		if typeOf.Implements(_repeatMinType) {
+			min = reflect.Zero(typeOf).Interface().(repeatMin).repeatMin()
+		}
 
 		p, err := compileInternal(typeOf.Elem(), "")
 		if err != nil {
 			return nil, err
 		}
 
-		return &sliceParser{Min: min, Delimiter: delimiter, Parser: p}, nil
+		delimiter, err := compileDelimiter(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		return &sliceParser{Min: min, listDelimiter: delimiter, Parser: p}, nil
+
+	case reflect.Map:
+		return compileMap(typeOf, tag)
+
+	case reflect.Interface:
+		return compileInterface(typeOf)
 
 	case reflect.Ptr:
 		p, err := compileInternal(typeOf.Elem(), tag)
@@ -302,3 +772,103 @@ func compileType(typeOf reflect.Type, tag reflect.StructTag) (p parser, err erro
 		return nil, fmt.Errorf("Invalid argument for Compile: unsupported type '%v'", typeOf)
 	}
 }
+
+var _stringType = reflect.TypeOf("")
+var _firstOfType = reflect.TypeOf(FirstOf{})
+
+// Compile map parser. Tags:
+// kv - key/value separator literal (default "="),
+// delimiter, delimiterRegexp or delimiterType - delimiter of entries,
+// dup - policy of duplicate keys handling: error (default), last or first,
+// parse - "+" if map must contain at least one entry.
+func compileMap(typeOf reflect.Type, tag reflect.StructTag) (parser, error) {
+	res := &mapParser{}
+
+	if tag.Get("parse") == "+" {
+		res.Min = 1
+	}
+
+	switch tag.Get("dup") {
+	case "", "error":
+		res.Dup = mapDupError
+	case "last":
+		res.Dup = mapDupLast
+	case "first":
+		res.Dup = mapDupFirst
+	default:
+		return nil, fmt.Errorf("Invalid dup tag value `%s' for %v", tag.Get("dup"), typeOf)
+	}
+
+	kv, ok := tag.Lookup("kv")
+	if !ok {
+		kv = "="
+	}
+
+	var err error
+	res.KV, err = compileInternal(_stringType, reflect.StructTag(fmt.Sprintf("literal:%q", kv)))
+	if err != nil {
+		return nil, err
+	}
+
+	res.Key, err = compileInternal(typeOf.Key(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	res.Value, err = compileInternal(typeOf.Elem(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	res.listDelimiter, err = compileDelimiter(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Compile parser for list delimiter. Delimiter could be specified by one of tags:
+// delimiterType (name of registered type), delimiterRegexp or delimiter (literal).
+// Delimiters of type or regexp must be saved into a field (`delimiters` tag) or written as literal
+// from `delimiterWrite` tag because we can't produce them from zero value.
+func compileDelimiter(tag reflect.StructTag) (listDelimiter, error) {
+	var res listDelimiter
+	var err error
+
+	if name := tag.Get("delimiterType"); name != "" {
+		tp, ok := _registeredTypes[name]
+		if !ok {
+			return res, fmt.Errorf("Unknown delimiter type `%s'", name)
+		}
+
+		res.DelimType = tp
+		res.Delimiter, err = compileInternal(tp, "")
+	} else if rx := tag.Get("delimiterRegexp"); rx != "" {
+		res.DelimType = _stringType
+		res.Delimiter, err = compileInternal(_stringType, reflect.StructTag(fmt.Sprintf("regexp:%q", rx)))
+		if err == nil && tag.Get("delimiterWrite") != "" {
+			if !regexp.MustCompile("^(?:" + rx + ")$").MatchString(tag.Get("delimiterWrite")) {
+				err = fmt.Errorf("Delimiter `%s' doesn't match regular expression %s", tag.Get("delimiterWrite"), rx)
+			}
+		}
+	} else if lit := tag.Get("delimiter"); lit != "" {
+		res.DelimType = _stringType
+		res.DelimWrite = lit
+		res.Delimiter, err = compileInternal(_stringType, reflect.StructTag(fmt.Sprintf("literal:%q", lit)))
+		return res, err
+	} else {
+		return res, nil
+	}
+
+	if err != nil {
+		return res, err
+	}
+
+	res.DelimWrite = tag.Get("delimiterWrite")
+	if res.DelimWrite == "" && tag.Get("delimiters") == "" {
+		return res, fmt.Errorf("Delimiter %v must be saved with delimiters tag or have delimiterWrite tag", res.Delimiter)
+	}
+
+	return res, nil
+}
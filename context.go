@@ -0,0 +1,150 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// ContextParser is Parser that has access to the parsing process: it could skip whitespace, parse values of other
+// types using the grammar and report errors at any location. Values parsed with ParseInto use packrat table and
+// left recursion is supported for rules containing ContextParser.
+type ContextParser interface {
+	// This function must parse value from ctx.Buffer() at location loc and return new location or error
+	ParseValue(ctx *Context, loc int) (newLocation int, err error)
+	// This function must write value into the output stream (see Parser.WriteValue).
+	WriteValue(out io.Writer) error
+}
+
+// Context is passed to ContextParser. It is valid only while ParseValue is executed.
+type Context struct {
+	ctx *parseContext
+}
+
+// Buffer returns the whole input being parsed.
+func (c *Context) Buffer() []byte {
+	return c.ctx.str
+}
+
+// SkipWS skips whitespace at location loc using current whitespace skipping function and returns new location.
+func (c *Context) SkipWS(loc int) int {
+	return c.ctx.skipWS(loc)
+}
+
+// ParseInto parses value pointed by ptr at location loc using the grammar of its type. Whitespace after the value
+// is skipped. Returns new location or Error.
+func (c *Context) ParseInto(ptr interface{}, loc int) (int, error) {
+	valueOf := reflect.ValueOf(ptr)
+	if valueOf.Kind() != reflect.Ptr || valueOf.IsNil() {
+		return -1, errors.New("Invalid argument for ParseInto: waiting for pointer")
+	}
+
+	p, err := compileContext(valueOf.Type().Elem())
+	if err != nil {
+		return -1, err
+	}
+
+	e := Error{Str: c.ctx.str}
+	l := c.ctx.parse(valueOf.Elem(), p, loc, &e)
+	if l < 0 {
+		return -1, e
+	}
+
+	c.ctx.end = l
+	return c.ctx.skipWS(l), nil
+}
+
+// Parsers compiled for ParseInto. Compiled parsers are never changed, so we don't need to take compilation lock and
+// to search for left recursion on each call.
+var _contextParsers sync.Map
+
+// Get compiled parser for ParseInto.
+func compileContext(typeOf reflect.Type) (parser, error) {
+	if p, ok := _contextParsers.Load(typeOf); ok {
+		return p.(parser), nil
+	}
+
+	p, err := compile(typeOf, reflect.StructTag(""))
+	if err != nil {
+		return nil, err
+	}
+
+	_contextParsers.Store(typeOf, p)
+
+	return p, nil
+}
+
+// Errorf returns syntax error at location loc.
+func (c *Context) Errorf(loc int, format string, args ...interface{}) error {
+	return Error{Str: c.ctx.str, Location: loc, Message: fmt.Sprintf(format, args...)}
+}
+
+// State returns current user state (see Options.State).
+func (c *Context) State() interface{} {
+	return c.ctx.state()
+}
+
+// SetState sets new user state. State is restored on backtracking so it must not be changed in place.
+func (c *Context) SetState(state interface{}) {
+	c.ctx.setState(state)
+}
+
+var _contextParserType = reflect.TypeOf((*ContextParser)(nil)).Elem()
+
+// Parser of types implementing ContextParser
+type contextParser struct {
+	idHolder
+	nonTerminal
+	ptr bool
+}
+
+func (par *contextParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	var v ContextParser
+	if par.ptr {
+		v = valueOf.Addr().Interface().(ContextParser)
+	} else {
+		if valueOf.Kind() == reflect.Ptr {
+			// Pointed value could be shared with packrat table so we always allocate new one:
+			valueOf.Set(reflect.New(valueOf.Type().Elem()))
+		}
+		v = valueOf.Interface().(ContextParser)
+	}
+
+	l, e := v.ParseValue(&Context{ctx: ctx}, location)
+	if e != nil {
+		if ev, ok := e.(Error); ok {
+			err.Location = ev.Location
+			err.Message = ev.Message
+			err.Err = ev.Err
+		} else {
+			err.Location = location
+			err.Message = e.Error()
+		}
+		return -1
+	}
+
+	if l < location || l > len(ctx.str) {
+		panic("Invalid parser")
+	}
+
+	return l
+}
+
+func (par *contextParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	if valueOf.Kind() == reflect.Ptr && valueOf.IsNil() {
+		return errEmptyValue
+	}
+
+	if par.ptr {
+		return valueOf.Addr().Interface().(ContextParser).WriteValue(userWriter(out))
+	}
+
+	return valueOf.Interface().(ContextParser).WriteValue(userWriter(out))
+}
+
+func (par *contextParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	// We don't know what values will be parsed with ParseInto, so we must use packrat table for this parser
+	return true, true
+}
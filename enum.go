@@ -0,0 +1,214 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Literal of enumeration and its value.
+type enumEntry struct {
+	Literal string
+	Value   reflect.Value
+}
+
+// Parser of integer or string values defined by set of literals (`enum` tag or Enum method).
+type enumParser struct {
+	idHolder
+	terminal
+	Entries []enumEntry
+	// Error message
+	err string
+}
+
+// Compile enumeration parser for integer or string type. Literals are taken from `enum` tag or from the result of
+// method Enum() map[string]T of the type. Returns nil if type is not enumeration.
+func compileEnum(typeOf reflect.Type, tag reflect.StructTag) (parser, error) {
+	switch typeOf.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.String:
+	default:
+		return nil, nil
+	}
+
+	var entries []enumEntry
+	var err error
+	if spec, ok := tag.Lookup("enum"); ok {
+		entries, err = parseEnumTag(typeOf, spec)
+		if err != nil {
+			return nil, err
+		}
+	} else if method, ok := typeOf.MethodByName("Enum"); ok && isEnumMethod(typeOf, method) {
+		table := method.Func.Call([]reflect.Value{reflect.Zero(typeOf)})[0]
+		for _, key := range table.MapKeys() {
+			entries = append(entries, enumEntry{key.String(), table.MapIndex(key)})
+		}
+
+		// Map order is random so we sort entries to make Write deterministic:
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Literal < entries[j].Literal
+		})
+	} else {
+		return nil, nil
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("Empty enumeration %v", typeOf)
+	}
+
+	literals := make([]string, len(entries))
+	for i, e := range entries {
+		if e.Literal == "" {
+			return nil, fmt.Errorf("Empty literal in enumeration %v", typeOf)
+		}
+		literals[i] = e.Literal
+	}
+
+	return &enumParser{Entries: entries, err: "Waiting for one of: " + strings.Join(literals, ", ")}, nil
+}
+
+// Check signature of Enum method. Methods with other signatures are not related to enumerations and are ignored.
+func isEnumMethod(typeOf reflect.Type, method reflect.Method) bool {
+	return method.Type.NumIn() == 1 && method.Type.NumOut() == 1 && method.Type.Out(0) == reflect.MapOf(_stringType, typeOf)
+}
+
+// Parse comma separated list of LITERAL=VALUE entries of `enum` tag. If value is omitted it is index of the entry
+// for integers and the literal itself for strings. Literal is separated from the value by the last '=' sign, so
+// "+=" is literal without value and "+==1" is literal "+=" with value 1. Value of integer enumeration could be
+// symbolic name (for example "+=Add,plus=Add,-=Sub"): names are numbered from zero in order of their first use, so
+// they match constants declared with iota in the same order. Numeric value equal to the value of symbolic name is
+// an error because such literals could not be distinguished.
+func parseEnumTag(typeOf reflect.Type, spec string) ([]enumEntry, error) {
+	var res []enumEntry
+	names := make(map[string]int)
+	// Literals with numeric and symbolic values by value:
+	numeric := make(map[interface{}]string)
+	symbolic := make(map[interface{}]string)
+	for i, item := range strings.Split(spec, ",") {
+		lit := item
+		s := ""
+		if eq := strings.LastIndex(item, "="); eq > 0 && eq < len(item)-1 {
+			lit, s = item[:eq], item[eq+1:]
+		}
+
+		for _, e := range res {
+			if e.Literal == lit {
+				return nil, fmt.Errorf("Duplicate literal `%s' in enumeration %v", lit, typeOf)
+			}
+		}
+
+		v := reflect.New(typeOf).Elem()
+		if typeOf.Kind() == reflect.String {
+			if s == "" {
+				s = lit
+			}
+			v.SetString(s)
+			res = append(res, enumEntry{lit, v})
+			continue
+		}
+
+		ord := i
+		isName := isEnumName(s)
+		if isName {
+			n, ok := names[s]
+			if !ok {
+				n = len(names)
+				names[s] = n
+			}
+			ord = n
+			s = ""
+		}
+
+		switch typeOf.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			x := int64(ord)
+			if s != "" {
+				var err error
+				x, err = strconv.ParseInt(s, 0, typeOf.Bits())
+				if err != nil {
+					return nil, fmt.Errorf("Invalid value `%s' of `%s' in enumeration %v", s, lit, typeOf)
+				}
+			}
+			v.SetInt(x)
+
+		default:
+			x := uint64(ord)
+			if s != "" {
+				var err error
+				x, err = strconv.ParseUint(s, 0, typeOf.Bits())
+				if err != nil {
+					return nil, fmt.Errorf("Invalid value `%s' of `%s' in enumeration %v", s, lit, typeOf)
+				}
+			}
+			v.SetUint(x)
+		}
+
+		other, same := symbolic, numeric
+		if isName {
+			other, same = numeric, symbolic
+		}
+		if o, ok := other[v.Interface()]; ok {
+			return nil, fmt.Errorf("Value of `%s' is the same as value of `%s' in enumeration %v", lit, o, typeOf)
+		}
+		if _, ok := same[v.Interface()]; !ok {
+			same[v.Interface()] = lit
+		}
+
+		res = append(res, enumEntry{lit, v})
+	}
+
+	return res, nil
+}
+
+// Check if value of enumeration entry is symbolic name: identifier that doesn't start with digit.
+func isEnumName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if !isIdentByte(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (par *enumParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	// Find the longest literal:
+	idx := -1
+	for i, e := range par.Entries {
+		if (idx < 0 || len(e.Literal) > len(par.Entries[idx].Literal)) && ctx.operatorAt(location, e.Literal) {
+			idx = i
+		}
+	}
+
+	if idx < 0 {
+		err.Location = location
+		err.Message = par.err
+		return -1
+	}
+
+	valueOf.Set(par.Entries[idx].Value)
+
+	return location + len(par.Entries[idx].Literal)
+}
+
+func (par *enumParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	for _, e := range par.Entries {
+		if e.Value.Interface() == valueOf.Interface() {
+			_, err := out.Write([]byte(e.Literal))
+			return err
+		}
+	}
+
+	return fmt.Errorf("Value %v is not in enumeration %v", valueOf.Interface(), valueOf.Type())
+}
+
+func (par *enumParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, false
+}
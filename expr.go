@@ -0,0 +1,412 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Assoc is associativity of binary operator.
+type Assoc int
+
+const (
+	// AssocLeft means that a op b op c is (a op b) op c
+	AssocLeft Assoc = iota
+	// AssocRight means that a op b op c is a op (b op c)
+	AssocRight
+	// AssocNone means that a op b op c is syntax error
+	AssocNone
+)
+
+// OperatorKind is kind of operator: infix (binary), prefix or postfix.
+type OperatorKind int
+
+const (
+	// Infix is binary operator placed between operands
+	Infix OperatorKind = iota
+	// Prefix is unary operator placed before operand
+	Prefix
+	// Postfix is unary operator placed after operand
+	Postfix
+)
+
+// Operator describes one operator in the precedence table.
+type Operator struct {
+	// Operator literal
+	Op string
+	// Precedence level. Operators with bigger precedence bind tighter.
+	Prec int
+	// Associativity (used only for infix operators)
+	Assoc Assoc
+	// Kind of operator
+	Kind OperatorKind
+}
+
+// OperatorTable is implemented by types describing operators of BinaryExpr.
+// Method is called on zero value of the type.
+type OperatorTable interface {
+	Operators() []Operator
+}
+
+// BinaryExpr is expression parsed using precedence climbing. Operand is type of expression operand
+// and Ops is type of operators table. Expression could also contain parenthesized subexpressions.
+//
+// Parsed expression is tree of BinaryExpr nodes:
+//
+//	Operand != nil              - operand
+//	Left != nil && Right != nil - binary operation Left Op Right
+//	Left == nil && Right != nil - prefix operation Op Right
+//	Left != nil && Right == nil - postfix operation Left Op
+//
+// Parentheses are not saved in the tree. Write outputs minimal count of parentheses required
+// to parse the same tree.
+type BinaryExpr[Operand any, Ops OperatorTable] struct {
+	Left    *BinaryExpr[Operand, Ops]
+	Op      string
+	Right   *BinaryExpr[Operand, Ops]
+	Operand *Operand
+}
+
+func (BinaryExpr[Operand, Ops]) binaryExprInfo() (reflect.Type, []Operator) {
+	var ops Ops
+	return reflect.TypeOf((*Operand)(nil)).Elem(), ops.Operators()
+}
+
+type binaryExpr interface {
+	binaryExprInfo() (reflect.Type, []Operator)
+}
+
+var _binaryExprType = reflect.TypeOf((*binaryExpr)(nil)).Elem()
+
+// Indexes of BinaryExpr fields:
+const (
+	exprLeft = iota
+	exprOp
+	exprRight
+	exprOperand
+)
+
+// Lowest possible precedence level
+const exprMinPrec = math.MinInt32
+
+// Expression parser
+type exprParser struct {
+	idHolder
+	nonTerminal
+	Operand parser
+	// Operators sorted by length (longest first)
+	infix   []Operator
+	prefix  []Operator
+	postfix []Operator
+}
+
+func compileExpr(typeOf reflect.Type) (parser, error) {
+	operandType, ops := reflect.Zero(typeOf).Interface().(binaryExpr).binaryExprInfo()
+
+	p, err := compileInternal(operandType, "")
+	if err != nil {
+		return nil, err
+	}
+
+	res := &exprParser{Operand: p}
+	for _, op := range ops {
+		if op.Op == "" {
+			return nil, fmt.Errorf("Empty operator in the table of %v", typeOf)
+		}
+
+		switch op.Kind {
+		case Infix:
+			res.infix = append(res.infix, op)
+		case Prefix:
+			res.prefix = append(res.prefix, op)
+		case Postfix:
+			res.postfix = append(res.postfix, op)
+		default:
+			return nil, fmt.Errorf("Invalid kind of operator `%s' in %v", op.Op, typeOf)
+		}
+	}
+
+	for _, lst := range [][]Operator{res.infix, res.prefix, res.postfix} {
+		sort.SliceStable(lst, func(i, j int) bool {
+			return len(lst[i].Op) > len(lst[j].Op)
+		})
+	}
+
+	return res, nil
+}
+
+// Check if operator is at location. Operators ending with identifier characters must not be followed by identifier character.
+func (ctx *parseContext) operatorAt(location int, op string) bool {
+	if !strAt(ctx.str, location, op) {
+		return false
+	}
+
+	l := location + len(op)
+	return !(isIdentByte(op[len(op)-1]) && l < len(ctx.str) && isIdentByte(ctx.str[l]))
+}
+
+func (par *exprParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	return par.parseExpr(ctx, valueOf, location, exprMinPrec, err)
+}
+
+// Replace value with new node with specified left and right operands.
+func setExprNode(valueOf reflect.Value, left, right reflect.Value, op string) {
+	valueOf.Set(reflect.Zero(valueOf.Type()))
+	if left.IsValid() {
+		valueOf.Field(exprLeft).Set(left)
+	}
+	valueOf.Field(exprOp).SetString(op)
+	if right.IsValid() {
+		valueOf.Field(exprRight).Set(right)
+	}
+}
+
+// Parse expression containing operators with precedence at least minPrec.
+func (par *exprParser) parseExpr(ctx *parseContext, valueOf reflect.Value, location int, minPrec int, err *Error) int {
+	location = par.parseUnary(ctx, valueOf, location, err)
+	if location < 0 {
+		return location
+	}
+
+	nonePrec := exprMinPrec
+	for {
+		pos := ctx.skipWS(location)
+		found := false
+
+		for _, op := range par.postfix {
+			if op.Prec >= minPrec && ctx.operatorAt(pos, op.Op) && !par.longerInfixAt(ctx, pos, len(op.Op)) {
+				left := reflect.New(valueOf.Type())
+				left.Elem().Set(valueOf)
+				setExprNode(valueOf, left, reflect.Value{}, op.Op)
+				location = pos + len(op.Op)
+				found = true
+				break
+			}
+		}
+
+		if found {
+			continue
+		}
+
+		for _, op := range par.infix {
+			if op.Prec < minPrec || !ctx.operatorAt(pos, op.Op) {
+				continue
+			}
+
+			if op.Assoc == AssocNone && op.Prec == nonePrec {
+				err.Location = pos
+				err.Message = fmt.Sprintf("Operator `%s' is not associative", op.Op)
+				return -1
+			}
+
+			next := op.Prec + 1
+			if op.Assoc == AssocRight {
+				next = op.Prec
+			}
+
+			right := reflect.New(valueOf.Type())
+			l := par.parseExpr(ctx, right.Elem(), ctx.skipWS(pos+len(op.Op)), next, err)
+			if l < 0 {
+				continue
+			}
+
+			left := reflect.New(valueOf.Type())
+			left.Elem().Set(valueOf)
+			setExprNode(valueOf, left, right, op.Op)
+			location = l
+			found = true
+
+			if op.Assoc == AssocNone {
+				nonePrec = op.Prec
+			} else {
+				nonePrec = exprMinPrec
+			}
+			break
+		}
+
+		if !found {
+			return location
+		}
+	}
+}
+
+// Check if there is infix operator longer than l at location (for example != and !).
+func (par *exprParser) longerInfixAt(ctx *parseContext, location int, l int) bool {
+	for _, op := range par.infix {
+		if len(op.Op) > l && ctx.operatorAt(location, op.Op) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parse prefix operation, parenthesized expression or operand.
+func (par *exprParser) parseUnary(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	maxError := Error{Str: ctx.str, Location: -1, Message: "Waiting for expression"}
+	updateError := func() {
+		if err.Location > maxError.Location {
+			maxError.Location = err.Location
+			maxError.Message = err.Message
+			maxError.Err = err.Err
+		}
+	}
+
+	for _, op := range par.prefix {
+		if !ctx.operatorAt(location, op.Op) {
+			continue
+		}
+
+		right := reflect.New(valueOf.Type())
+		l := par.parseExpr(ctx, right.Elem(), ctx.skipWS(location+len(op.Op)), op.Prec, err)
+		if l >= 0 {
+			setExprNode(valueOf, reflect.Value{}, right, op.Op)
+			return l
+		}
+		updateError()
+	}
+
+	if strAt(ctx.str, location, "(") {
+		l := par.parseExpr(ctx, valueOf, ctx.skipWS(location+1), exprMinPrec, err)
+		if l >= 0 {
+			l = ctx.skipWS(l)
+			if strAt(ctx.str, l, ")") {
+				return l + 1
+			}
+
+			err.Location = l
+			err.Message = "Waiting for ')'"
+			err.Err = nil
+		}
+		updateError()
+	}
+
+	operand := reflect.New(valueOf.Field(exprOperand).Type().Elem())
+	l := ctx.parse(operand.Elem(), par.Operand, location, err)
+	if l < 0 {
+		updateError()
+		err.Location = maxError.Location
+		err.Message = maxError.Message
+		err.Err = maxError.Err
+		return -1
+	}
+
+	valueOf.Set(reflect.Zero(valueOf.Type()))
+	valueOf.Field(exprOperand).Set(operand)
+
+	return l
+}
+
+// Find operator description for the node.
+func (par *exprParser) nodeOperator(valueOf reflect.Value) (Operator, error) {
+	var lst []Operator
+	left := !valueOf.Field(exprLeft).IsNil()
+	right := !valueOf.Field(exprRight).IsNil()
+
+	if left && right {
+		lst = par.infix
+	} else if right {
+		lst = par.prefix
+	} else if left {
+		lst = par.postfix
+	} else {
+		return Operator{}, errors.New("Empty expression node")
+	}
+
+	op := valueOf.Field(exprOp).String()
+	for _, o := range lst {
+		if o.Op == op {
+			return o, nil
+		}
+	}
+
+	return Operator{}, fmt.Errorf("Unknown operator `%s'", op)
+}
+
+func (par *exprParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	return par.writeExpr(out, valueOf, exprMinPrec)
+}
+
+// Write expression adding parentheses if precedence of the node is less than minPrec.
+func (par *exprParser) writeExpr(out io.Writer, valueOf reflect.Value, minPrec int) error {
+	if !valueOf.Field(exprOperand).IsNil() {
+		return par.Operand.WriteValue(out, valueOf.Field(exprOperand).Elem())
+	}
+
+	op, err := par.nodeOperator(valueOf)
+	if err != nil {
+		return err
+	}
+
+	if op.Prec < minPrec {
+		_, err = out.Write([]byte("("))
+		if err != nil {
+			return err
+		}
+
+		err = par.writeExpr(out, valueOf, exprMinPrec)
+		if err != nil {
+			return err
+		}
+
+		_, err = out.Write([]byte(")"))
+		return err
+	}
+
+	opText := op.Op
+	switch op.Kind {
+	case Infix:
+		leftPrec, rightPrec := op.Prec, op.Prec+1
+		if op.Assoc != AssocLeft {
+			leftPrec = op.Prec + 1
+		}
+		if op.Assoc == AssocRight {
+			rightPrec = op.Prec
+		}
+
+		err = par.writeExpr(out, valueOf.Field(exprLeft).Elem(), leftPrec)
+		if err != nil {
+			return err
+		}
+
+		_, err = out.Write([]byte(" " + opText + " "))
+		if err != nil {
+			return err
+		}
+
+		return par.writeExpr(out, valueOf.Field(exprRight).Elem(), rightPrec)
+
+	case Prefix:
+		if isIdentByte(opText[len(opText)-1]) {
+			opText += " "
+		}
+
+		_, err = out.Write([]byte(opText))
+		if err != nil {
+			return err
+		}
+
+		return par.writeExpr(out, valueOf.Field(exprRight).Elem(), op.Prec)
+
+	default:
+		err = par.writeExpr(out, valueOf.Field(exprLeft).Elem(), op.Prec)
+		if err != nil {
+			return err
+		}
+
+		if isIdentByte(opText[0]) {
+			opText = " " + opText
+		}
+
+		_, err = out.Write([]byte(opText))
+		return err
+	}
+}
+
+func (par *exprParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	possible, _ = isLRPossible(par.Operand, parsers)
+	return possible, false
+}
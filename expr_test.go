@@ -0,0 +1,84 @@
+package parse
+
+import (
+	"testing"
+)
+
+type arithOps struct{}
+
+func (arithOps) Operators() []Operator {
+	return []Operator{
+		{Op: "==", Prec: 1, Assoc: AssocNone},
+		{Op: "+", Prec: 2},
+		{Op: "-", Prec: 2},
+		{Op: "*", Prec: 3},
+		{Op: "/", Prec: 3},
+		{Op: "**", Prec: 4, Assoc: AssocRight},
+		{Op: "-", Prec: 5, Kind: Prefix},
+		{Op: "not", Prec: 0, Kind: Prefix},
+		{Op: "!", Prec: 6, Kind: Postfix},
+	}
+}
+
+type arithExpr = BinaryExpr[uint64, arithOps]
+
+type eTst struct {
+	input, result string
+	ok            bool
+}
+
+var eTests = []eTst{
+	{"1 + 2 * 3", "1 + 2 * 3", true},
+	{"(1 + 2) * 3", "(1 + 2) * 3", true},
+	{"((1 - 2)) - 3", "1 - 2 - 3", true},
+	{"1 - (2 - 3)", "1 - (2 - 3)", true},
+	{"2 ** 3 ** 4", "2 ** 3 ** 4", true},
+	{"(2 ** 3) ** 4", "(2 ** 3) ** 4", true},
+	{"-2 ** 2", "-2 ** 2", true},
+	{"(-2) ** 2", "-2 ** 2", true},
+	{"-(2 ** 2)", "-(2 ** 2)", true},
+	{"3! * 2", "3! * 2", true},
+	{"not 1 == 2", "not 1 == 2", true},
+	{"1 + not 2", "1 + (not 2)", true},
+	{"1 == (2 == 3)", "1 == (2 == 3)", true},
+	{"1 == 2 == 3", "", false},
+}
+
+func TestBinaryExpr(t *testing.T) {
+	for _, tst := range eTests {
+		var e arithExpr
+		l, err := Parse(&e, []byte(tst.input), nil)
+		if !tst.ok {
+			if err == nil && l == len(tst.input) {
+				t.Errorf("Parsed invalid expression `%s'", tst.input)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Can't parse `%s': %v", tst.input, err)
+			continue
+		}
+
+		if l != len(tst.input) {
+			t.Errorf("Expression `%s' parsed only until %d", tst.input, l)
+		}
+
+		res, err := Append(nil, e)
+		if err != nil {
+			t.Errorf("Can't write `%s': %v", tst.input, err)
+		} else if string(res) != tst.result {
+			t.Errorf("Invalid output for `%s': `%s' != `%s'", tst.input, string(res), tst.result)
+		}
+	}
+
+	var e arithExpr
+	_, err := Parse(&e, []byte("1 - 2 * 3 - 4"), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if e.Op != "-" || e.Right.Operand == nil || *e.Right.Operand != 4 || e.Left.Op != "-" || e.Left.Right.Op != "*" {
+		t.Errorf("Invalid expression tree")
+	}
+}
@@ -0,0 +1,325 @@
+package parse
+
+import (
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Indentation-sensitive grammars support.
+//
+// Newline, Indent and Dedent are marker types that could be used as fields of the structures to parse
+// Python-like or YAML-like languages. For example:
+//
+//	type Block struct {
+//		_     string `literal:":"`
+//		_     parse.Newline
+//		_     parse.Indent
+//		Stmts []Stmt
+//		_     parse.Dedent
+//	}
+//
+// Whitespace skipping function must not skip newlines (use SkipBlanks or your own function).
+// Parser keeps stack of indentation levels. Indent pushes the level and Dedent pops it.
+// The stack is restored on backtracking. Inside of the indented block the first token of each line must be indented
+// to the current level (only Newline, Indent and Dedent could be placed at another indentation).
+
+// Newline matches newline ("\n" or "\r\n") and all following empty lines.
+type Newline struct{}
+
+// EOL matches newline ("\n" or "\r\n") or end of the input. It could be used as terminator of line in line-oriented
+// formats together with SkipInlineSpaces. Unlike Newline it doesn't skip following empty lines.
+type EOL struct{}
+
+// Indent matches beginning of the line indented more than current indentation level.
+// The indentation of the line becomes the current level.
+type Indent struct{}
+
+// Dedent matches beginning of the line (or end of the input) indented less than current indentation level.
+// Previous indentation level becomes the current level. Line must be indented to one of the previous levels.
+type Dedent struct{}
+
+// Width of tabulation used to calculate indentation.
+const indentTabWidth = 8
+
+// String used to write one indentation level.
+const indentString = "    "
+
+// Element of indentation levels stack.
+type indentLevel struct {
+	column int
+	prev   *indentLevel
+}
+
+// Get current indentation level
+func (ctx *parseContext) indentColumn() int {
+	if ctx.indent == nil {
+		return 0
+	}
+
+	return ctx.indent.column
+}
+
+// Get indentation of the line if location is at the beginning of the line (after blanks).
+func (ctx *parseContext) lineIndent(location int) (int, bool) {
+	if location >= len(ctx.str) {
+		return 0, true
+	}
+
+	start := location
+	for start > 0 && ctx.str[start-1] != '\n' {
+		start--
+	}
+
+	col := 0
+	for i := start; i < location; i++ {
+		switch ctx.str[i] {
+		case ' ':
+			col++
+		case '\t':
+			col = (col/indentTabWidth + 1) * indentTabWidth
+		default:
+			return 0, false
+		}
+	}
+
+	return col, true
+}
+
+// Check that the first token of the line is indented to the current level.
+func (ctx *parseContext) checkOffside(p parser, location int, err *Error) bool {
+	switch p.(type) {
+	case *newlineParser, *eolParser, *indentParser, *dedentParser:
+		return true
+	}
+
+	if location >= len(ctx.str) {
+		return true
+	}
+
+	col, ok := ctx.lineIndent(location)
+	if !ok || col == ctx.indent.column {
+		return true
+	}
+
+	err.Location = location
+	err.Message = "Invalid indentation"
+	return false
+}
+
+// Check for newline at location and return location after it.
+func newlineAt(str []byte, location int) int {
+	if strAt(str, location, "\n") {
+		return location + 1
+	} else if strAt(str, location, "\r\n") {
+		return location + 2
+	}
+
+	return -1
+}
+
+type newlineParser struct {
+	idHolder
+	terminal
+}
+
+func (par *newlineParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	l := newlineAt(ctx.str, location)
+	if l < 0 {
+		err.Location = location
+		err.Message = "Waiting for newline"
+		return -1
+	}
+
+	// Skip empty lines:
+	for {
+		nl := newlineAt(ctx.str, ctx.skipWS(l))
+		if nl < 0 {
+			return l
+		}
+		l = nl
+	}
+}
+
+func (par *newlineParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	if w, ok := out.(*indentWriter); ok {
+		_, err := w.out.Write([]byte("\n"))
+		w.lineStart = true
+		return err
+	}
+
+	_, err := out.Write([]byte("\n"))
+	return err
+}
+
+func (par *newlineParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, false
+}
+
+type eolParser struct {
+	idHolder
+	terminal
+}
+
+func (par *eolParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	if location >= len(ctx.str) {
+		return location
+	}
+
+	l := newlineAt(ctx.str, location)
+	if l < 0 {
+		err.Location = location
+		err.Message = "Waiting for end of line"
+	}
+
+	return l
+}
+
+func (par *eolParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	if w, ok := out.(*indentWriter); ok {
+		w.lineStart = true
+		out = w.out
+	}
+
+	_, err := out.Write([]byte("\n"))
+	return err
+}
+
+func (par *eolParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, true
+}
+
+type indentParser struct {
+	idHolder
+	terminal
+}
+
+func (par *indentParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	col, ok := ctx.lineIndent(location)
+	if !ok || location >= len(ctx.str) {
+		err.Location = location
+		err.Message = "Waiting for indented line"
+		return -1
+	}
+
+	if col <= ctx.indentColumn() {
+		err.Location = location
+		err.Message = "Waiting for indent"
+		return -1
+	}
+
+	ctx.indent = &indentLevel{column: col, prev: ctx.indent}
+
+	return location
+}
+
+func (par *indentParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	if w, ok := out.(*indentWriter); ok {
+		w.depth++
+	}
+
+	return nil
+}
+
+func (par *indentParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, true
+}
+
+type dedentParser struct {
+	idHolder
+	terminal
+}
+
+func (par *dedentParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	col, ok := ctx.lineIndent(location)
+	if !ok {
+		err.Location = location
+		err.Message = "Waiting for the beginning of line"
+		return -1
+	}
+
+	if ctx.indent == nil || col >= ctx.indent.column {
+		err.Location = location
+		err.Message = "Waiting for dedent"
+		return -1
+	}
+
+	ctx.indent = ctx.indent.prev
+	if col > ctx.indentColumn() {
+		err.Location = location
+		err.Message = "Unindent does not match any outer indentation level"
+		return -1
+	}
+
+	return location
+}
+
+func (par *dedentParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	if w, ok := out.(*indentWriter); ok && w.depth > 0 {
+		w.depth--
+	}
+
+	return nil
+}
+
+func (par *dedentParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, true
+}
+
+// Get writer for WriteValue methods of user types. Outside of indented blocks it is the writer passed to Write, so
+// user code could check its type. Output of values inside of indented blocks must be indented, so the internal
+// writer is used there.
+func userWriter(out io.Writer) io.Writer {
+	if w, ok := out.(*indentWriter); ok && w.depth == 0 {
+		return w.out
+	}
+
+	return out
+}
+
+// Writer that writes indentation at the beginning of each line written after Newline.
+type indentWriter struct {
+	out       io.Writer
+	depth     int
+	lineStart bool
+	// Default spellings of boolean values (see WriteWithOptions)
+	bools []boolPair
+}
+
+func (w *indentWriter) Write(data []byte) (int, error) {
+	if len(data) > 0 && w.lineStart {
+		w.lineStart = false
+		_, err := w.out.Write([]byte(strings.Repeat(indentString, w.depth)))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return w.out.Write(data)
+}
+
+// SkipBlanks skips spaces and tabulations but not newlines.
+func SkipBlanks(str []byte, loc int) int {
+	for i := loc; i < len(str); i++ {
+		if str[i] != ' ' && str[i] != '\t' {
+			return i
+		}
+	}
+
+	return len(str)
+}
+
+// SkipInlineSpaces skips spaces, tabulations and line continuations (backslash followed by newline) but not newlines.
+func SkipInlineSpaces(str []byte, loc int) int {
+	for loc < len(str) {
+		if str[loc] == ' ' || str[loc] == '\t' {
+			loc++
+		} else if str[loc] == '\\' && newlineAt(str, loc+1) > 0 {
+			loc = newlineAt(str, loc+1)
+		} else {
+			break
+		}
+	}
+
+	return loc
+}
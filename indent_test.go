@@ -0,0 +1,121 @@
+package parse
+
+import (
+	"testing"
+)
+
+type pyStmt struct {
+	FirstOf
+	If     *pyIf
+	Simple pySimple
+}
+
+type pySimple struct {
+	Name string `regexp:"[a-z]+"`
+	_    Newline
+}
+
+type pyIf struct {
+	_    string `literal:"if"`
+	Cond string `regexp:"[a-z]+"`
+	_    string `literal:":"`
+	_    Newline
+	_    Indent
+	Body []pyStmt `parse:"+"`
+	_    Dedent
+}
+
+type pyFile struct {
+	Stmts []pyStmt
+}
+
+var pySource = `a
+if b:
+  c
+
+  if d:
+      e
+      f
+  g
+h
+`
+
+func TestIndent(t *testing.T) {
+	opts := &Options{SkipWhite: SkipBlanks}
+
+	var f pyFile
+	l, err := Parse(&f, []byte(pySource), opts)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if l != len(pySource) || len(f.Stmts) != 3 {
+		t.Fatalf("Invalid result (%d): %d statements", l, len(f.Stmts))
+	}
+
+	body := f.Stmts[1].If.Body
+	if len(body) != 3 || body[1].Field != "If" || len(body[1].If.Body) != 2 || body[2].Simple.Name != "g" {
+		t.Errorf("Invalid block structure")
+	}
+
+	res, err := Append(nil, f)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	expected := "a\nifb:\n    c\n    ifd:\n        e\n        f\n    g\nh\n"
+	if string(res) != expected {
+		t.Errorf("Invalid output:\n%s", string(res))
+	}
+
+	for _, s := range []string{"if a:\nb\n", "if a:\n    b\n  c\n"} {
+		l, err = Parse(&f, []byte(s), opts)
+		if err == nil && l == len(s) {
+			t.Errorf("Parsed invalid indentation: %q", s)
+		}
+	}
+}
+
+type iniValue struct {
+	Value string `regexp:"[a-z0-9]+"`
+}
+
+type iniLine struct {
+	Key    string `regexp:"[a-z]+"`
+	_      string `literal:"="`
+	Values []iniValue
+	_      EOL
+}
+
+func TestEOL(t *testing.T) {
+	opts := &Options{SkipWhite: SkipInlineSpaces}
+	src := "a = 1 2\nb = 3 \\\n  4\r\nc = 5"
+
+	var lines []iniLine
+	l, err := Parse(&lines, []byte(src), opts)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if l != len(src) || len(lines) != 3 {
+		t.Fatalf("Invalid result (%d): %d lines", l, len(lines))
+	}
+
+	if len(lines[0].Values) != 2 || len(lines[1].Values) != 2 || lines[1].Values[1].Value != "4" || lines[2].Values[0].Value != "5" {
+		t.Errorf("Invalid values: %v", lines)
+	}
+
+	res, err := Append(nil, lines)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if string(res) != "a=12\nb=34\nc=5\n" {
+		t.Errorf("Invalid output: %q", string(res))
+	}
+
+	src = "a = 1 b = 2\n"
+	l, err = Parse(&lines, []byte(src), opts)
+	if err == nil && l == len(src) {
+		t.Errorf("Parsed lines without newline")
+	}
+}
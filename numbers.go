@@ -0,0 +1,105 @@
+package parse
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// Dialect of numeric literals used by int, uint and float parsers.
+type numberDialect struct {
+	// Regular expressions for signed and unsigned integers and for floating point numbers
+	intRe   *regexp.Regexp
+	uintRe  *regexp.Regexp
+	floatRe *regexp.Regexp
+	// Characters of suffixes removed before conversion (for example 10UL or 1.5f in C)
+	intSuffix   string
+	floatSuffix string
+	// Base for strconv functions: 0 means that base is detected by prefix
+	base int
+	// Numbers with leading zeros (007) are errors
+	noLeadingZeros bool
+}
+
+// Regular expressions find extent of the number. Exact syntax (for example placement of underscores in Go
+// floats) is checked by strconv functions.
+const (
+	goInteger = `(0[xX](_?[0-9a-fA-F])+|0[bB](_?[01])+|0[oO](_?[0-7])+|0(_?[0-7])*|[1-9](_?[0-9])*)`
+	goFloat   = `(0[xX][0-9a-fA-F_]*(\.[0-9a-fA-F_]*)?[pP][-+]?[0-9_]+|([0-9][0-9_]*(\.[0-9_]*)?|\.[0-9][0-9_]*)([eE][-+]?[0-9_]+)?)`
+
+	cInteger = `(0[xX][0-9a-fA-F]+|0[bB][01]+|0[0-7]*|[1-9][0-9]*)(?i:u(ll?)?|ll?u?)?`
+	cFloat   = `(0[xX]([0-9a-fA-F]+\.?[0-9a-fA-F]*|\.[0-9a-fA-F]+)[pP][-+]?[0-9]+|([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?)[fFlL]?`
+
+	jsonInteger = `(0|[1-9][0-9]*)`
+	jsonFloat   = `-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?`
+
+	plainFloat = `[-+]?(([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?|(?i:inf(inity)?|nan))`
+)
+
+// Registered number dialects that could be used in `number` tag and in Options.NumberDialect.
+var _numberDialects = map[string]*numberDialect{
+	// Go 1.13+ literals: 0x1F, 0b1010, 0o17, 017, 1_000_000, 1., 0x1p-2
+	"go": {
+		intRe:   regexp.MustCompile(`^-?` + goInteger),
+		uintRe:  regexp.MustCompile(`^` + goInteger),
+		floatRe: regexp.MustCompile(`^[-+]?` + goFloat),
+		base:    0,
+	},
+	// C literals: 0x1F, 017, 0b1010, 10UL, 1.5f, 0x1p-2
+	"c": {
+		intRe:       regexp.MustCompile(`^-?` + cInteger),
+		uintRe:      regexp.MustCompile(`^` + cInteger),
+		floatRe:     regexp.MustCompile(`^[-+]?` + cFloat),
+		intSuffix:   "uUlL",
+		floatSuffix: "fFlL",
+		base:        0,
+	},
+	// JSON numbers: decimal numbers without leading zeros
+	"json": {
+		intRe:          regexp.MustCompile(`^-?` + jsonInteger),
+		uintRe:         regexp.MustCompile(`^` + jsonInteger),
+		floatRe:        regexp.MustCompile(`^` + jsonFloat),
+		base:           10,
+		noLeadingZeros: true,
+	},
+	// Plain decimal numbers: leading zeros are allowed, floats could be Inf or NaN
+	"plain": {
+		intRe:   regexp.MustCompile(`^[-+]?[0-9]+`),
+		uintRe:  regexp.MustCompile(`^\+?[0-9]+`), // '+' is removed before conversion
+		floatRe: regexp.MustCompile(`^` + plainFloat),
+		base:    10,
+	},
+}
+
+// Get number dialect by name. Empty name means Go dialect.
+func getNumberDialect(name string) (*numberDialect, error) {
+	if name == "" {
+		name = "go"
+	}
+
+	d, ok := _numberDialects[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown number dialect `%s'", name)
+	}
+
+	return d, nil
+}
+
+// Get dialect from `number` tag. Returns nil if tag is not set.
+func compileNumberDialect(tag reflect.StructTag) (*numberDialect, error) {
+	name := tag.Get("number")
+	if name == "" {
+		return nil, nil
+	}
+
+	return getNumberDialect(name)
+}
+
+// Get dialect of numbers for parser: dialect of the field or default dialect.
+func (ctx *parseContext) numberDialect(d *numberDialect) *numberDialect {
+	if d != nil {
+		return d
+	}
+
+	return ctx.numbers
+}
@@ -181,3 +181,99 @@ func TestPackrat(t *testing.T) {
 		fmt.Println("")
 	}
 }
+
+/* Precedence and associativity of left recursive alternatives: */
+type PrecExpr struct {
+	FirstOf
+	Assign *struct {
+		L *PrecExpr
+		_ string `literal:"="`
+		R *PrecExpr
+	} `prec:"1" assoc:"right"`
+	Less *struct {
+		L *PrecExpr
+		_ string `literal:"<"`
+		R *PrecExpr
+	} `prec:"2" assoc:"none"`
+	Add *struct {
+		L  *PrecExpr
+		Op string `regexp:"[-+]"`
+		R  *PrecExpr
+	} `prec:"3"`
+	Mul *struct {
+		L  *PrecExpr
+		Op string `regexp:"[*/]"`
+		R  *PrecExpr
+	} `prec:"4"`
+	Pow *struct {
+		L *PrecExpr
+		_ string `literal:"^"`
+		R *PrecExpr
+	} `prec:"5" assoc:"right"`
+	Call *struct {
+		F *PrecExpr
+		_ string `literal:"("`
+		A *PrecExpr
+		_ string `literal:")"`
+	} `prec:"6"`
+	Braced *struct {
+		_ string `literal:"("`
+		E *PrecExpr
+		_ string `literal:")"`
+	}
+	N string `regexp:"[a-z0-9]+"`
+}
+
+func (e *PrecExpr) String() string {
+	switch e.Field {
+	case "Assign":
+		return "(" + e.Assign.L.String() + "=" + e.Assign.R.String() + ")"
+	case "Less":
+		return "(" + e.Less.L.String() + "<" + e.Less.R.String() + ")"
+	case "Add":
+		return "(" + e.Add.L.String() + e.Add.Op + e.Add.R.String() + ")"
+	case "Mul":
+		return "(" + e.Mul.L.String() + e.Mul.Op + e.Mul.R.String() + ")"
+	case "Pow":
+		return "(" + e.Pow.L.String() + "^" + e.Pow.R.String() + ")"
+	case "Call":
+		return e.Call.F.String() + "[" + e.Call.A.String() + "]"
+	case "Braced":
+		return e.Braced.E.String()
+	}
+
+	return e.N
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		input, result string
+		l             int
+	}{
+		{"1 - 2 - 3", "((1-2)-3)", 9},
+		{"1 + 2 * 3 - 4", "((1+(2*3))-4)", 13},
+		{"a = b = c + 1", "(a=(b=(c+1)))", 13},
+		{"2 ^ 3 ^ 2 * 2", "((2^(3^2))*2)", 13},
+		{"(1 - 2) ^ 3", "((1-2)^3)", 11},
+		{"a < b + 1", "(a<(b+1))", 9},
+		{"a < b < c", "(a<b)", 6},
+		{"f(1 + 2)", "f[(1+2)]", 8},
+		{"f(a = b)(c) * 2", "(f[(a=b)][c]*2)", 15},
+		{"1 + f((2 - 3) * 4)", "(1+f[((2-3)*4)])", 18},
+	}
+
+	for _, packrat := range []bool{false, true} {
+		for _, tst := range tests {
+			var e PrecExpr
+			l, err := Parse(&e, []byte(tst.input), &Options{SkipWhite: SkipSpaces, PackratEnabled: packrat})
+			if err != nil {
+				t.Errorf("Can't parse `%s': %v", tst.input, err)
+				continue
+			}
+
+			if l != tst.l || e.String() != tst.result {
+				t.Errorf("Invalid result for `%s' (packrat: %v): %s (%d)", tst.input, packrat, e.String(), l)
+			}
+		}
+	}
+}
@@ -28,7 +28,7 @@ simply parse int64 with Parse:
 	var i int64
 	newLocation, err := parse.Parse(&i, []byte("123"), nil)
 
-If you need to parse variant types you need to insert FirstOf as first field in your structure:
+If you need to parse variant types you need to embed FirstOf into your structure (usually as the first field):
 
 	type StringOrInt struct {
 		FirstOf
@@ -37,34 +37,118 @@ If you need to parse variant types you need to insert FirstOf as first field in
 	}
 	newLocation, err := parse.Parse(new(StringOrInt), `"I can parse Go string!"`, nil)
 
+Embedded structures are inlined: their fields are parsed as fields of the outer structure, so common groups of fields
+could be shared between structures. Embedded pointer to structure is optional group: it is nil if the group is not present:
+
+	type Var struct {
+		_ string `literal:"var"`
+		Name
+		*TypeSpec
+		_ string `literal:";"`
+	}
+
 Optional fields must be of pointer type and contain `optional:"true"` tag. You can use slices that
 will be parsed as ELEMENT* or ELEMENT+ (if `repeat:"+"` was set in tag). You can specify another tags and types listed bellow.
 
+Instead of tags you can use generic types: And[T] and Not[T] for lookahead, Opt[T] for optional elements,
+Many[T] and Many1[T] for repetitions and SepBy[T, Sep] for lists with separators. They could be nested freely:
+
+	type Let struct {
+		_     string `literal:"let"`
+		Names parse.SepBy[parse.Many1[Ident], Comma]
+		Body  parse.Opt[Expr]
+	}
+
 	+-------------+-------------+----------------------------------------------------+
 	| Type        | Tag         | Description                                        |
 	+-------------+-------------+----------------------------------------------------+
 	| string      |             | Parse Go string. `string` and "string" are both    |
 	|             |             | supported.                                         |
 	+-------------+-------------+----------------------------------------------------+
+	| string      | string      | Dialect of string literal: go (default), json,     |
+	|             |             | sql ('...' with '' escape), python (prefixes r, b, |
+	|             |             | u and triple quotes) or shell (word with quotes    |
+	|             |             | and escapes). Write uses escaping of the dialect.  |
+	+-------------+-------------+----------------------------------------------------+
 	| string      | regexp      | Parse regular expression in regexp module syntax.  |
 	+-------------+-------------+----------------------------------------------------+
 	| string      | literal     | Parse literal specified in tag. If there are both  |
 	|             |             | regexp and literal specified regexp will be used.  |
 	+-------------+-------------+----------------------------------------------------+
+	| string,     | parse       | If parse == "raw" source text of the string parsed |
+	| []byte      |             | by other tags is saved (for example string literal |
+	|             |             | is saved with quotes and escapes).                 |
+	+-------------+-------------+----------------------------------------------------+
+	| string,     | chars       | Parse characters from the set specified in syntax  |
+	| rune        |             | of regexp character class without brackets, for    |
+	|             |             | example "a-zA-Z_" or "^0-9". Faster than regexp.   |
+	+-------------+-------------+----------------------------------------------------+
+	| string,     | unicode     | Parse characters of Unicode categories or scripts, |
+	| rune        |             | for example "L,Nd". Could be used with chars tag.  |
+	+-------------+-------------+----------------------------------------------------+
+	| string      | min, max    | Count of characters for chars and unicode tags.    |
+	|             |             | Default is one or more characters.                 |
+	+-------------+-------------+----------------------------------------------------+
 	| int*        |             | Parse integer constant. Hexadecimal, Octal and     |
 	|             |             | decimal constants supported. int32 and rune types  |
 	|             |             | are the same type in Go, so int32 parse characters |
 	|             |             | in Go syntax.                                      |
 	+-------------+-------------+----------------------------------------------------+
+	| int*, uint*,| number      | Dialect of numeric literals: go (default: 0x1F,    |
+	| float*      |             | 0b101, 0o17, 017, 1_000, 1., 0x1p-2), c (suffixes  |
+	|             |             | like 10UL and 1.5f), json (no leading zeros) or    |
+	|             |             | plain (decimal, floats could be Inf and NaN).      |
+	|             |             | Default is set by Options.NumberDialect.           |
+	+-------------+-------------+----------------------------------------------------+
 	| int*        | parse       | If tag parse:"#" was set parser will save current  |
 	|             |             | location in this field and will not advance one.   |
 	+-------------+-------------+----------------------------------------------------+
 	| uint*       |             | Same as int* but unsigned constant.                |
 	+-------------+-------------+----------------------------------------------------+
+	| int*, uint*,| enum        | Comma separated LITERAL=VALUE entries. The longest |
+	| string      |             | matching literal is parsed and its value is saved. |
+	|             |             | If value is omitted it is index of the entry (or   |
+	|             |             | the literal for strings). Integer value could be   |
+	|             |             | symbolic name ("+=Add,-=Sub"): names are numbered  |
+	|             |             | from zero in order of their first use and must not |
+	|             |             | clash with numeric values. Write outputs the first |
+	|             |             | literal of the value. Named types could define     |
+	|             |             | method Enum() map[string]T instead of the tag.     |
+	+-------------+-------------+----------------------------------------------------+
 	| float*      |             | Parse floating point number.                       |
 	+-------------+-------------+----------------------------------------------------+
 	| bool        |             | Parse boolean constant (true or false)             |
 	+-------------+-------------+----------------------------------------------------+
+	| bool        | bool        | Comma separated pairs of true/false spellings, for |
+	|             |             | example "yes/no,on/off,1/0". Write uses the first  |
+	|             |             | pair. Default is set by Options.BoolSpellings.     |
+	|             |             | Spelling ending with letter, digit or '_' must not |
+	|             |             | be followed by such character (as true and false). |
+	+-------------+-------------+----------------------------------------------------+
+	| *big.Int    |             | Parse integer of any size. Hexadecimal (0x),       |
+	|             |             | octal (0 or 0o) and binary (0b) integers and '_'   |
+	|             |             | separators are supported.                          |
+	+-------------+-------------+----------------------------------------------------+
+	| *big.Float  | precision   | Parse floating point number with precision in bits |
+	|             |             | specified by tag (default is 64).                  |
+	+-------------+-------------+----------------------------------------------------+
+	| *big.Rat    |             | Parse rational number: integer, fraction (3/4) or  |
+	|             |             | decimal number (1.25e-3). Written as fraction.     |
+	+-------------+-------------+----------------------------------------------------+
+	| time.Time   | layout      | Parse time in format specified by layout (see      |
+	|             |             | time.Parse) or by name of standard layout: rfc3339 |
+	|             |             | (default), rfc1123, datetime, dateonly, kitchen... |
+	+-------------+-------------+----------------------------------------------------+
+	| time.       |             | Parse duration in Go syntax: 1h30m, 1.5s, -20ms.   |
+	| Duration    |             |                                                    |
+	+-------------+-------------+----------------------------------------------------+
+	| complex*    |             | Parse complex constant in Go syntax: 1+2i, 3i,     |
+	|             |             | -0.5e3i, 1_000.5, 0x1p-2+0x10i or 1.5. Binary and  |
+	|             |             | octal components are not supported.                |
+	+-------------+-------------+----------------------------------------------------+
+	| complex*    | complex     | If complex is "pair" parse number as (re, im)      |
+	|             |             | tuple of floating point numbers.                   |
+	+-------------+-------------+----------------------------------------------------+
 	| []type      | parse       | Parse sequence of type. If parse is not specified  |
 	|             |             | or parse is '*' here could be zero or more         |
 	|             |             | elements. If parse is '+' here could be one or     |
@@ -75,6 +159,56 @@ will be parsed as ELEMENT* or ELEMENT+ (if `repeat:"+"` was set in tag). You can
 	|             |             | like lists so I think that it is good idea to      |
 	|             |             | support such lists out of the box.                 |
 	+-------------+-------------+----------------------------------------------------+
+	| []type      | delimiter-  | Parse list with delimiter matched by regular       |
+	|             | Regexp      | expression.                                        |
+	+-------------+-------------+----------------------------------------------------+
+	| []type      | delimiter-  | Parse list with delimiter of type registered with  |
+	|             | Type        | RegisterType.                                      |
+	+-------------+-------------+----------------------------------------------------+
+	| []type      | delimiter-  | Literal written by Write between elements if       |
+	|             | Write       | delimiters are not saved with delimiters tag. It   |
+	|             |             | is required for delimiterRegexp and delimiterType  |
+	|             |             | without delimiters tag.                            |
+	+-------------+-------------+----------------------------------------------------+
+	| []type      | delimiters  | Name of the []delimiter-type field to save parsed  |
+	|             |             | delimiters into. This field is not parsed itself   |
+	|             |             | and is used by Write to output delimiters. If      |
+	|             |             | there is no other delimiter tag delimiter is       |
+	|             |             | parsed as type of elements of this field.          |
+	+-------------+-------------+----------------------------------------------------+
+	| map[K]V     | kv          | Parse list of KEY KV VALUE entries. kv is literal  |
+	|             |             | separating key and value (default is "=").         |
+	|             |             | Delimiter of entries is specified by the same tags |
+	|             |             | as for slices (including delimiters and            |
+	|             |             | delimiterWrite). If parse is '+' map must contain  |
+	|             |             | at least one entry. Write outputs entries sorted   |
+	|             |             | by keys and saved delimiters in parsed order.      |
+	+-------------+-------------+----------------------------------------------------+
+	| map[K]V     | dup         | Duplicate keys handling: error (default), last or  |
+	|             |             | first (value of the last or first entry is used).  |
+	+-------------+-------------+----------------------------------------------------+
+	| string      | match       | Name of the string field declared before. Input    |
+	|             |             | must contain value of this field at this position  |
+	|             |             | (closing tags, heredoc terminators).               |
+	+-------------+-------------+----------------------------------------------------+
+	| string      | until       | Name of the string field declared before. Text     |
+	|             |             | until value of this field is parsed. Terminator is |
+	|             |             | not consumed: use another field with match tag.    |
+	+-------------+-------------+----------------------------------------------------+
+	| encoding.   | regexp,     | Types implementing encoding.TextUnmarshaler with   |
+	| Text-       | chars,      | one of these tags: text of the value is matched by |
+	| Unmarshaler | unicode     | the tag and decoded with UnmarshalText. Write uses |
+	|             |             | MarshalText. Big numbers and time types are always |
+	|             |             | parsed by their own parsers.                       |
+	+-------------+-------------+----------------------------------------------------+
+	| Raw[T]      |             | Parse T and save both value and its source text.   |
+	|             |             | Write outputs source text if it is not empty.      |
+	+-------------+-------------+----------------------------------------------------+
+	| interface   |             | Parse one of alternatives registered with          |
+	|             |             | RegisterAlternatives. Alternatives are tried in    |
+	|             |             | order of registration and the first parsed value   |
+	|             |             | is stored. Write uses dynamic type of the value.   |
+	+-------------+-------------+----------------------------------------------------+
 	| *type       | parse       | Parse type. Element will be allocated or set to nil|
 	|             |             | for optional elements that doesn't present. If     |
 	|             |             | parse was specified and set to '?' element is      |
@@ -86,10 +220,48 @@ will be parsed as ELEMENT* or ELEMENT+ (if `repeat:"+"` was set in tag). You can
 	|             |             | by element: it will be parsed but position will not|
 	|             |             | be increased. If parse == "!" it is not predicate: |
 	|             |             | element must not be present at this position.      |
+	|             |             | If parse == "lexical" whitespace is not skipped    |
+	|             |             | inside of the element (see Token).                 |
+	+-------------+-------------+----------------------------------------------------+
+	| any         | skip        | Comma separated list of names of whitespace        |
+	|             |             | skipping functions used inside of the element      |
+	|             |             | (see RegisterSkipper) or "none". Outer function is |
+	|             |             | restored after the element.                        |
 	+-------------+-------------+----------------------------------------------------+
 	| any         | set         | If present this tag contains name of the method to |
 	|             |             | call after parsing of element. Method must have    |
-	|             |             | signature func (x element-type) error.             |
+	|             |             | signature func (x element-type) error. If method   |
+	|             |             | returns error the element is not parsed (other     |
+	|             |             | alternatives are tried) and Error returned by      |
+	|             |             | Parse has *SetError cause containing the span of   |
+	|             |             | the element. Method with signature                 |
+	|             |             | func (x element-type, state interface{})           |
+	|             |             | (interface{}, error) receives user state and       |
+	|             |             | returns new one (see Options.State).               |
+	+-------------+-------------+----------------------------------------------------+
+	| any         | check       | Name of the method to validate parsed element:     |
+	|             |             | func (x element-type) bool or error. If method     |
+	|             |             | returns false or error element is not matched and  |
+	|             |             | parser tries next alternative. Method could have   |
+	|             |             | second argument state interface{} to receive user  |
+	|             |             | state.                                             |
+	+-------------+-------------+----------------------------------------------------+
+	| any         | prec        | Precedence of FirstOf alternative (integer, bigger |
+	|             |             | binds tighter). See bellow.                        |
+	+-------------+-------------+----------------------------------------------------+
+	| any         | assoc       | Associativity of FirstOf alternative with prec:    |
+	|             |             | left (default), right or none.                     |
+	+-------------+-------------+----------------------------------------------------+
+	| Newline     |             | Parse newline and following empty lines.           |
+	+-------------+-------------+----------------------------------------------------+
+	| EOL         |             | Parse newline or end of the input. Use it with     |
+	|             |             | SkipInlineSpaces to parse line-oriented formats.   |
+	+-------------+-------------+----------------------------------------------------+
+	| Indent      |             | Parse beginning of the line indented more than     |
+	|             |             | current level and push new indentation level.      |
+	+-------------+-------------+----------------------------------------------------+
+	| Dedent      |             | Parse beginning of the line indented less than     |
+	|             |             | current level and pop indentation level.           |
 	+-------------+-------------+----------------------------------------------------+
 
 Parser supports left recursion out of the box so you can parse expressions without a problem. For example you can parse this grammar:
@@ -109,6 +281,42 @@ with
 		N uint64
 
 	}
+
+Left recursive rules always produce left-associative trees. If you need operators with different precedence and
+associativity you can mark FirstOf alternatives with prec and assoc tags. Operands of such alternative must be pointers to
+the rule itself: first one is left operand, others are right operands. Alternatives without prec tag are primary expressions.
+
+	type E struct {
+		FirstOf
+		Assign *struct {
+			L *E
+			_ string `literal:"="`
+			R *E
+		} `prec:"1" assoc:"right"`
+		Add *struct {
+			L  *E
+			Op string `regexp:"[-+]"`
+			R  *E
+		} `prec:"2"`
+		N uint64
+	}
+
+For binary expressions with operators precedence you can use BinaryExpr type. It parses expression using
+precedence climbing with operators table specified by type implementing OperatorTable:
+
+	type Ops struct{}
+
+	func (Ops) Operators() []parse.Operator {
+		return []parse.Operator{
+			{Op: "+", Prec: 1}, {Op: "-", Prec: 1},
+			{Op: "*", Prec: 2}, {Op: "/", Prec: 2},
+			{Op: "**", Prec: 3, Assoc: parse.AssocRight},
+			{Op: "-", Prec: 4, Kind: parse.Prefix},
+		}
+	}
+
+	var expr parse.BinaryExpr[int64, Ops]
+	newLocation, err := parse.Parse(&expr, []byte("1 + 2 * (3 - 4)"), nil)
 */
 package parse
 
@@ -117,6 +325,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
 )
 
 // Error is parse error representation.
@@ -128,6 +337,36 @@ type Error struct {
 	Location int
 	// Error message
 	Message string
+	// Cause of the error: *SetError if method of `set` tag has failed or nil
+	Err error
+}
+
+// Unwrap returns cause of the error.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// SetError is returned (as cause of Error) if method specified in `set` tag returns error.
+// Such error is ordinary parse failure: alternatives are tried and error with the furthest location is returned.
+type SetError struct {
+	// Name of method
+	Method string
+	// Name of field
+	Field string
+	// Span of the field value in the input (without following whitespace)
+	Start int
+	End   int
+	// Error returned by method
+	Err error
+}
+
+func (e *SetError) Error() string {
+	return fmt.Sprintf("%s of %s [%d:%d]: %v", e.Method, e.Field, e.Start, e.End, e.Err)
+}
+
+// Unwrap returns error returned by method.
+func (e *SetError) Unwrap() error {
+	return e.Err
 }
 
 // FirstOf is structure that indicates that we need to parse first expression of the fields of structure.
@@ -137,6 +376,11 @@ type FirstOf struct {
 	Field string
 }
 
+// Token is marker for lexical structures. If Token is embedded into the structure whitespace is not skipped
+// between fields of this structure (but it is skipped before the structure).
+// The same effect has tag `parse:"lexical"` on the field.
+type Token struct{}
+
 // Returns error string of parse error.
 // It is well-formed version of error so you can simply write it to user.
 func (e Error) Error() string {
@@ -173,13 +417,30 @@ func (e Error) Error() string {
 type Parser interface {
 	// This function must parse value from buffer and return length or error
 	ParseValue(buf []byte, loc int) (newLocation int, err error)
-	// This function must write value into the output stream.
+	// This function must write value into the output stream. out is the writer passed to Write unless the value
+	// is inside of indented block (see Indent): there it is wrapper that indents written lines.
+	WriteValue(out io.Writer) error
+}
+
+// StatefulParser is Parser that has access to user state (see Options.State). ParseValue receives current state and
+// returns new state. State is restored on backtracking so state must never be changed in place: return modified copy
+// instead.
+type StatefulParser interface {
+	// This function must parse value from buffer and return length and new state or error
+	ParseValue(buf []byte, loc int, state interface{}) (newLocation int, newState interface{}, err error)
+	// This function must write value into the output stream (see Parser.WriteValue).
 	WriteValue(out io.Writer) error
 }
 
 type packratKey struct {
 	rule     uint
 	location int
+	// Precedence level (see precPlan)
+	level int
+	// Whitespace skipping mode (see skipParser)
+	skip int
+	// State of the parser before parsing
+	state parseState
 }
 
 type packratValue struct {
@@ -196,6 +457,11 @@ type packratValue struct {
 	// Error
 	msg         string
 	errLocation int
+	cause       error
+	// State of the parser after parsing
+	state parseState
+	// Location after the value before trailing whitespace (see parseContext.end)
+	end int
 }
 
 // Parse context
@@ -207,6 +473,73 @@ type parseContext struct {
 	packrat map[packratKey]*packratValue
 	// Locations with recursive rules:
 	recursiveLocations map[int]bool
+	// Precedence levels for operands of the alternative with precedence
+	plan precPlan
+	// Precedence level for the rule being parsed
+	level int
+	// Current whitespace skipping function and its key for packrat table
+	skip    func(str []byte, loc int) int
+	skipKey int
+	// Stack of indentation levels
+	indent *indentLevel
+	// User state
+	user *userState
+	// Default dialect of numbers
+	numbers *numberDialect
+	// Default spellings of boolean values
+	bools []boolPair
+	// Location after the last parsed field before whitespace skipped after it (used by Raw to exclude whitespace
+	// and comments from the text)
+	end int
+}
+
+// State of the parser that must be restored on backtracking.
+// Fields of this structure must never be changed in place, so the state could be used as part of packrat key.
+type parseState struct {
+	indent *indentLevel
+	user   *userState
+}
+
+// User state (see Options.State). Each change of the state allocates new value, so pointers to userState identify
+// the state in packrat table. Even equal values set by different changes are different keys, so results cached
+// before the change are never reused after it.
+type userState struct {
+	value interface{}
+}
+
+// Get current state of the parser.
+func (ctx *parseContext) snapshot() parseState {
+	return parseState{indent: ctx.indent, user: ctx.user}
+}
+
+// Restore state of the parser.
+func (ctx *parseContext) restore(state parseState) {
+	ctx.indent = state.indent
+	ctx.user = state.user
+}
+
+// Get current user state.
+func (ctx *parseContext) state() interface{} {
+	if ctx.user == nil {
+		return nil
+	}
+
+	return ctx.user.value
+}
+
+// Set new user state.
+func (ctx *parseContext) setState(value interface{}) {
+	ctx.user = &userState{value: value}
+}
+
+// Precedence levels for operands of FirstOf alternative with `prec` tag.
+// Left operand is the rule called at the location of alternative start, right operands are all others. The plan is
+// not active for fields between the first and the last fields of the alternative.
+type precPlan struct {
+	rule     uint
+	location int
+	left     int
+	right    int
 }
 
 func (pv packratValue) String() string {
@@ -223,7 +556,7 @@ func (ctx *parseContext) NewError(location int, msg string, args ...interface{})
 		s = fmt.Sprintf(msg, args...)
 	}
 
-	return Error{ctx.str, location, s}
+	return Error{Str: ctx.str, Location: location, Message: s}
 }
 
 // Show debug message if need to
@@ -235,31 +568,79 @@ func (ctx *parseContext) debug(msg string, args ...interface{}) {
 
 // Skip whitespace:
 func (ctx *parseContext) skipWS(loc int) int {
-	if ctx.params != nil {
-		if ctx.params.SkipWhite != nil {
-			l := ctx.params.SkipWhite(ctx.str, loc)
-			if l >= loc {
-				return l
-			}
+	if ctx.skip != nil {
+		l := ctx.skip(ctx.str, loc)
+		if l >= loc {
+			return l
 		}
 	}
 
 	return loc
 }
 
-// Internal parse function
+// Call ParseValue of the parser. If precedence plan is active for this rule level is set for it.
+// level is 0 if there is no plan and level + 1 otherwise.
+func (ctx *parseContext) callParser(valueOf reflect.Value, p parser, location int, err *Error, level int) int {
+	if ctx.plan.rule == 0 || ctx.plan.rule != p.ID() {
+		ctx.level = 0
+		return p.ParseValue(ctx, valueOf, location, err)
+	}
+
+	plan := ctx.plan
+	ctx.plan = precPlan{}
+	ctx.level = level - 1
+	l := p.ParseValue(ctx, valueOf, location, err)
+	ctx.plan = plan
+
+	return l
+}
+
+// Internal parse function. State of the parser is restored if parsing fails.
 func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, err *Error) int {
+	state := ctx.snapshot()
+	// Cause of the error is set by the rule itself:
+	err.Err = nil
+
+	l := ctx.parseRule(valueOf, p, location, err)
+	if l < 0 {
+		ctx.restore(state)
+	}
+
+	return l
+}
+
+// Parse rule using packrat table.
+func (ctx *parseContext) parseRule(valueOf reflect.Value, p parser, location int, err *Error) int {
 	ctx.debug("[PARSE {%v} %d %v]\n", p, location, ctx.params)
 
 	location = ctx.skipWS(location)
 
+	level := 0
+	if ctx.plan.rule != 0 {
+		if location == ctx.plan.location {
+			level = ctx.plan.left + 1
+		} else {
+			level = ctx.plan.right + 1
+		}
+	}
+
+	if ctx.indent != nil && p.IsTerm() && !ctx.checkOffside(p, location, err) {
+		return -1
+	}
+
+	if ctx.plan.rule != 0 && isPtrParser(p) {
+		// Pointer to operand of alternative with precedence is transparent for packrat table: pointed rule is saved
+		// in the table by itself. So left recursion is always detected on the pointed rule.
+		return ctx.callParser(valueOf, p, location, err, level)
+	}
+
 	if !ctx.params.PackratEnabled {
 		if p.IsLR() > 0 { // Left recursion is not possible
-			return p.ParseValue(ctx, valueOf, location, err)
+			return ctx.callParser(valueOf, p, location, err, level)
 		}
 	}
 
-	key := packratKey{p.ID(), location}
+	key := packratKey{p.ID(), location, level, ctx.skipKey, ctx.snapshot()}
 	cache, ok := ctx.packrat[key]
 	if ok {
 		ctx.debug("[CACHE [%d] %v]\n", location, cache)
@@ -267,9 +648,12 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 		if cache.parsed { // Cached value
 			if cache.newLocation >= 0 {
 				valueOf.Set(cache.value.Elem())
+				ctx.restore(cache.state)
+				ctx.end = cache.end
 			} else {
 				err.Location = cache.errLocation
 				err.Message = cache.msg
+				err.Err = cache.cause
 			}
 
 			ctx.debug("[RETURN %d %d %v]\n", cache.newLocation, cache.errLocation, cache.msg)
@@ -290,9 +674,12 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 		// Return previous recursion level result:
 		if cache.newLocation >= 0 {
 			valueOf.Set(cache.value.Elem())
+			ctx.restore(cache.state)
+			ctx.end = cache.end
 		} else {
 			err.Message = cache.msg
 			err.Location = cache.errLocation
+			err.Err = cache.cause
 		}
 
 		ctx.debug("[RETURN %d]\n", cache.newLocation)
@@ -300,7 +687,7 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 	}
 
 	ctx.packrat[key] = &packratValue{parsed: false, recursionLevel: 0, newLocation: location}
-	l := p.ParseValue(ctx, valueOf, location, err)
+	l := ctx.callParser(valueOf, p, location, err, level)
 	cache = ctx.packrat[key]
 
 	if cache.recursionLevel == 0 { // Not recursive
@@ -311,9 +698,12 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 				cache.parsed = true
 				cache.msg = err.Message
 				cache.errLocation = err.Location
+				cache.cause = err.Err
 				if l >= 0 {
 					cache.value = reflect.New(valueOf.Type())
 					cache.value.Elem().Set(valueOf)
+					cache.state = ctx.snapshot()
+					cache.end = ctx.end
 				}
 				cache.newLocation = l
 			}
@@ -330,9 +720,12 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 	cache.newLocation = l
 	cache.msg = err.Message
 	cache.errLocation = err.Location
+	cache.cause = err.Err
 	if l >= 0 {
 		cache.value = reflect.New(valueOf.Type())
 		cache.value.Elem().Set(valueOf)
+		cache.state = ctx.snapshot()
+		cache.end = ctx.end
 	}
 	cache.recursionLevel = 2
 
@@ -340,7 +733,9 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 		// We will parse n times until the error or stop of position increasing:
 		cache.recursionLevel = 2
 
-		l := p.ParseValue(ctx, valueOf, location, err)
+		// Each step starts from the same state:
+		ctx.restore(key.state)
+		l := ctx.callParser(valueOf, p, location, err, level)
 
 		// cache = ctx.packrat[key] // TODO: ???
 		if l < 0 { // This step was not good so we must return previous value
@@ -348,6 +743,8 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 
 			if cache.newLocation >= 0 {
 				valueOf.Set(cache.value.Elem())
+				ctx.restore(cache.state)
+				ctx.end = cache.end
 			}
 
 			ctx.debug("[RETURN %d]\n", cache.newLocation)
@@ -355,6 +752,8 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 			return cache.newLocation
 		} else if cache.newLocation >= 0 && l <= cache.newLocation { // End of recursion: there was no increasing of position
 			valueOf.Set(cache.value.Elem())
+			ctx.restore(cache.state)
+			ctx.end = cache.end
 			cache.parsed = true
 			cache.recursionLevel = 0
 			ctx.debug("[RETURN %d]\n", cache.newLocation)
@@ -366,6 +765,8 @@ func (ctx *parseContext) parse(valueOf reflect.Value, p parser, location int, er
 			cache.value = reflect.New(valueOf.Type())
 		}
 		cache.value.Elem().Set(valueOf)
+		cache.state = ctx.snapshot()
+		cache.end = ctx.end
 	}
 
 	//	ctx.debug("[RETURN %d %v]\n", l, err)
@@ -380,6 +781,16 @@ type Options struct {
 	PackratEnabled bool
 	// Enable grammar debugging messages. It is useful if you have some problems with grammar but produces a lot of output.
 	Debug bool
+	// Default dialect of numeric literals for fields without `number` tag: go (default), c, json or plain.
+	NumberDialect string
+	// Default spellings of boolean values for fields without `bool` tag, for example "yes/no,on/off".
+	// If not set values are true and false. WriteWithOptions uses the first pair for such fields.
+	BoolSpellings string
+	// Initial user state passed to StatefulParser values and to `set` and `check` methods with state argument.
+	// State is restored on backtracking. Options are not changed by parsing: use ParseWithState to get the final
+	// state. State is a part of packrat table key, so values parsed after each change of the state are not shared
+	// with values parsed before it: grammars changing state often benefit less from memoization.
+	State interface{}
 }
 
 // Parse value from string and return position after parsing and error.
@@ -389,11 +800,17 @@ type Options struct {
 // params is parsing parameters.
 // Function returns newLocation - location after the parsed string. On errors err != nil.
 func Parse(result interface{}, str []byte, params *Options) (newLocation int, err error) {
+	newLocation, _, err = ParseWithState(result, str, params)
+	return
+}
+
+// ParseWithState parses value like Parse and returns also the final user state (see Options.State).
+func ParseWithState(result interface{}, str []byte, params *Options) (newLocation int, state interface{}, err error) {
 	typeOf := reflect.TypeOf(result)
 	valueOf := reflect.ValueOf(result)
 
 	if typeOf.Kind() != reflect.Ptr {
-		return -1, errors.New("Invalid argument for Parse: waiting for pointer")
+		return -1, nil, errors.New("Invalid argument for Parse: waiting for pointer")
 	}
 
 	if params == nil {
@@ -402,22 +819,42 @@ func Parse(result interface{}, str []byte, params *Options) (newLocation int, er
 
 	p, err := compile(typeOf.Elem(), reflect.StructTag(""))
 	if err != nil {
-		return -1, err
+		return -1, nil, err
+	}
+
+	numbers, err := getNumberDialect(params.NumberDialect)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	bools := _defaultBoolPairs
+	if params.BoolSpellings != "" {
+		bools, err = parseBoolPairs(params.BoolSpellings)
+		if err != nil {
+			return -1, nil, err
+		}
 	}
 
 	C := new(parseContext)
+	C.numbers = numbers
+	C.bools = bools
 	C.params = params
 	C.str = str
 	C.packrat = make(map[packratKey]*packratValue)
 	C.recursiveLocations = make(map[int]bool)
+	C.skip = params.SkipWhite
+	if params.State != nil {
+		C.setState(params.State)
+	}
 
-	e := Error{str, 0, ""}
+	e := Error{Str: str}
 	newLocation = C.parse(valueOf.Elem(), p, 0, &e)
+
 	if newLocation < 0 {
-		return newLocation, e
+		return newLocation, nil, e
 	}
 
-	return newLocation, nil
+	return newLocation, C.state(), nil
 }
 
 // NewOptions creates new default parameters object.
@@ -448,6 +885,11 @@ func strAt(str []byte, loc int, s string) bool {
 	return false
 }
 
+// Check if byte could be part of identifier: [a-zA-Z0-9_]
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
 // SkipOneLineComment skips one-line comment that starts from begin and ends with newline or end of string
 func SkipOneLineComment(str []byte, loc int, begin string) int {
 	if strAt(str, loc, begin) {
@@ -523,7 +965,7 @@ func SkipLispComment(str []byte, loc int) int {
 
 // SkipTeXComment skips TeX style comment: "% .... \n"
 func SkipTeXComment(str []byte, loc int) int {
-	return SkipOneLineComment(str, loc, ";")
+	return SkipOneLineComment(str, loc, "%")
 }
 
 // SkipAll skips any count of any substrings defined by skip functions.
@@ -545,3 +987,62 @@ func SkipAll(str []byte, loc int, funcs ...func([]byte, int) int) int {
 		}
 	}
 }
+
+// Registered skip functions that could be used in `skip` tags.
+var _skippers = map[string]func([]byte, int) int{
+	"spaces": SkipSpaces,
+	"blanks": SkipBlanks,
+	"inline": SkipInlineSpaces,
+	"c":      SkipCComment,
+	"cpp":    SkipCPPComment,
+	"shell":  SkipShellComment,
+	"pascal": SkipPascalComment,
+	"html":   SkipHTMLComment,
+	"ada":    SkipAdaComment,
+	"lisp":   SkipLispComment,
+	"tex":    SkipTeXComment,
+}
+
+// Keys of packrat table for values of `skip` tags.
+var _skipperKeys = make(map[string]int)
+
+// RegisterSkipper registers whitespace skipping function with name. This name could be used in `skip` tag.
+// Predefined names are: spaces, blanks, inline, c, cpp, shell, pascal, html, ada, lisp and tex.
+// Skip functions must be registered before the first parsing of the types using them.
+func RegisterSkipper(name string, skip func(str []byte, loc int) int) {
+	_compileMutex.Lock()
+	defer _compileMutex.Unlock()
+
+	_skippers[name] = skip
+}
+
+// Get skip function and packrat key for value of `skip` tag. Value is comma separated list of registered names
+// or "none" to disable whitespace skipping.
+func getSkipper(names string) (func([]byte, int) int, int, error) {
+	if names == "none" {
+		return nil, skipKeyLexical, nil
+	}
+
+	var funcs []func([]byte, int) int
+	for _, name := range strings.Split(names, ",") {
+		f, ok := _skippers[strings.TrimSpace(name)]
+		if !ok {
+			return nil, 0, fmt.Errorf("Unknown skip function `%s'", name)
+		}
+		funcs = append(funcs, f)
+	}
+
+	key, ok := _skipperKeys[names]
+	if !ok {
+		key = len(_skipperKeys) + 1
+		_skipperKeys[names] = key
+	}
+
+	if len(funcs) == 1 {
+		return funcs[0], key, nil
+	}
+
+	return func(str []byte, loc int) int {
+		return SkipAll(str, loc, funcs...)
+	}, key, nil
+}
@@ -1,9 +1,12 @@
 package parse
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -174,3 +177,1113 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+type opToken struct {
+	Op string `regexp:"[-+]"`
+}
+
+type delimiterLists struct {
+	Rx    []int64 `delimiterRegexp:"[,;]" delimiters:"RxD"`
+	RxD   []string
+	_     string  `literal:"|"`
+	Tp    []int64 `delimiterType:"opToken" delimiters:"TpD"`
+	TpD   []opToken
+	_     string  `literal:"|"`
+	Auto  []int64 `delimiters:"AutoD"`
+	AutoD []opToken
+}
+
+func TestDelimiters(t *testing.T) {
+	RegisterType("opToken", opToken{})
+
+	var d delimiterLists
+	_, err := Parse(&d, []byte("1, 2; 3 | 4 + 5 - 6 | 7 - 8"), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(d.Rx) != 3 || len(d.RxD) != 2 || d.RxD[0] != "," || d.RxD[1] != ";" {
+		t.Errorf("Invalid regexp delimited list: %v %v", d.Rx, d.RxD)
+	}
+
+	if len(d.Tp) != 3 || len(d.TpD) != 2 || d.TpD[0].Op != "+" || d.TpD[1].Op != "-" {
+		t.Errorf("Invalid type delimited list: %v %v", d.Tp, d.TpD)
+	}
+
+	if len(d.Auto) != 2 || len(d.AutoD) != 1 || d.AutoD[0].Op != "-" {
+		t.Errorf("Invalid list with delimiters type from field: %v %v", d.Auto, d.AutoD)
+	}
+
+	res, err := Append(nil, d)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if string(res) != "1,2;3|4+5-6|7-8" {
+		t.Errorf("Invalid output: %s", string(res))
+	}
+
+	var d2 delimiterLists
+	_, err = Parse(&d2, res, nil)
+	if err != nil || !reflect.DeepEqual(d, d2) {
+		t.Errorf("Output was not parsed back: %v %v", d2, err)
+	}
+
+	var tr delimiterTrailing
+	_, err = Parse(&tr, []byte("1, 2; 3;"), nil)
+	if err != nil || len(tr.Rx) != 3 || len(tr.RxD) != 2 {
+		t.Fatalf("Delimiter after the last element was saved: %v %v", tr, err)
+	}
+
+	res, err = Append(nil, tr)
+	if err != nil || string(res) != "1,2;3;" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	var w delimiterWrites
+	_, err = Parse(&w, []byte("1, 2 | 3, 4; 5 | 6 - 7"), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	res, err = Append(nil, w)
+	if err != nil || string(res) != "1,2|3;4;5|6+7" {
+		t.Fatalf("Invalid output: %s %v", string(res), err)
+	}
+
+	var w2 delimiterWrites
+	_, err = Parse(&w2, res, nil)
+	if err != nil || !reflect.DeepEqual(w, w2) {
+		t.Errorf("Output was not parsed back: %v %v", w2, err)
+	}
+
+	var noWrite delimiterNoWrite
+	_, err = Parse(&noWrite, []byte("1,2"), nil)
+	if err == nil {
+		t.Errorf("Regexp delimiter without delimiters or delimiterWrite tag was accepted")
+	}
+
+	var badWrite delimiterBadWrite
+	_, err = Parse(&badWrite, []byte("1,2"), nil)
+	if err == nil {
+		t.Errorf("delimiterWrite not matching regexp was accepted")
+	}
+}
+
+type delimiterWrites struct {
+	Lit []int64 `delimiter:","`
+	_   string  `literal:"|"`
+	Rx  []int64 `delimiterRegexp:"[,;]" delimiterWrite:";"`
+	_   string  `literal:"|"`
+	Tp  []int64 `delimiterType:"opToken" delimiterWrite:"+"`
+}
+
+type delimiterTrailing struct {
+	Rx  []int64 `delimiterRegexp:"[,;]" delimiters:"RxD"`
+	RxD []string
+	_   string `literal:";"`
+}
+
+type delimiterNoWrite struct {
+	L []int64 `delimiterRegexp:"[,;]"`
+}
+
+type fieldCompileError struct {
+	A string `regexp:"("`
+}
+
+func TestFieldCompileError(t *testing.T) {
+	var v fieldCompileError
+	_, err := Parse(&v, []byte("a"), nil)
+	if err == nil {
+		t.Errorf("Invalid field was silently skipped")
+	}
+}
+
+type delimiterBadWrite struct {
+	L []int64 `delimiterRegexp:"[,;]" delimiterWrite:"."`
+}
+
+type hexToken struct {
+	Token
+	_      string `literal:"0x"`
+	Digits string `regexp:"[0-9a-fA-F]+"`
+}
+
+type qualifiedName struct {
+	Package string `regexp:"[a-z]+"`
+	_       string `literal:"."`
+	Name    string `regexp:"[a-zA-Z]+"`
+}
+
+type tokens struct {
+	Hex  []hexToken
+	_    string        `literal:";"`
+	Name qualifiedName `parse:"lexical"`
+}
+
+func TestLexical(t *testing.T) {
+	var v tokens
+	l, err := Parse(&v, []byte("  0x12 0xff ; fmt.Println"), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if l != 25 || len(v.Hex) != 2 || v.Hex[1].Digits != "ff" || v.Name.Name != "Println" {
+		t.Errorf("Invalid result (%d): %v", l, v)
+	}
+
+	for _, s := range []string{"0 x12 ; fmt.Println", "0x12 ; fmt .Println", "0x12 ; fmt. Println"} {
+		l, err = Parse(&v, []byte(s), nil)
+		if err == nil {
+			t.Errorf("Parsed `%s' with spaces inside of tokens (%d)", s, l)
+		}
+	}
+}
+
+type shellWord struct {
+	Word string `regexp:"[a-z]+"`
+}
+
+type shellSnippet struct {
+	_     string `literal:"{"`
+	Words []shellWord
+	_     string `literal:"}"`
+}
+
+type cLikeConfig struct {
+	Name  string       `regexp:"[a-z]+"`
+	_     string       `literal:"="`
+	Shell shellSnippet `skip:"spaces,shell"`
+	_     string       `literal:";"`
+}
+
+func TestSkipTag(t *testing.T) {
+	opts := &Options{SkipWhite: func(str []byte, loc int) int {
+		return SkipAll(str, loc, SkipSpaces, SkipCPPComment, SkipCComment)
+	}}
+
+	var v []cLikeConfig
+	src := "// config\na = { echo # comment\n hello } /* c */ ;\nb = {ls}; // end"
+	l, err := Parse(&v, []byte(src), opts)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if l != len(src) || len(v) != 2 || len(v[0].Shell.Words) != 2 || v[0].Shell.Words[1].Word != "hello" {
+		t.Errorf("Invalid result (%d): %v", l, v)
+	}
+
+	var c cLikeConfig
+	_, err = Parse(&c, []byte("a = { echo // comment\n };"), opts)
+	if err == nil {
+		t.Errorf("C++ comment skipped inside of shell snippet")
+	}
+	if l := SkipTeXComment([]byte("% comment\nx"), 0); l != 10 {
+		t.Errorf("TeX comment was not skipped: %d", l)
+	}
+}
+
+type mapDict struct {
+	_     string         `literal:"{"`
+	Items map[string]int `kv:":" delimiter:","`
+	_     string         `literal:"}"`
+}
+
+type mapDictLast struct {
+	_     string         `literal:"{"`
+	Items map[string]int `kv:":" delimiter:"," dup:"last"`
+	_     string         `literal:"}"`
+}
+
+type mapDictFirst struct {
+	_     string         `literal:"{"`
+	Items map[string]int `kv:":" delimiter:"," dup:"first"`
+	_     string         `literal:"}"`
+}
+
+func TestMap(t *testing.T) {
+	var d mapDict
+	src := `{ "b": 2, "c": 3, "a": 1 }`
+	l, err := Parse(&d, []byte(src), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if l != len(src) || len(d.Items) != 3 || d.Items["a"] != 1 || d.Items["b"] != 2 || d.Items["c"] != 3 {
+		t.Errorf("Invalid result (%d): %v", l, d.Items)
+	}
+
+	res, err := Append(nil, d)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if string(res) != `{"a":1,"b":2,"c":3}` {
+		t.Errorf("Invalid output: %s", string(res))
+	}
+
+	src = `{"a": 1, "a": 2}`
+	_, err = Parse(&d, []byte(src), nil)
+	if err == nil {
+		t.Errorf("Duplicate key was accepted")
+	}
+
+	var last mapDictLast
+	_, err = Parse(&last, []byte(src), nil)
+	if err != nil || last.Items["a"] != 2 {
+		t.Errorf("Invalid dup:\"last\" result: %v %v", err, last.Items)
+	}
+
+	var first mapDictFirst
+	_, err = Parse(&first, []byte(src), nil)
+	if err != nil || first.Items["a"] != 1 {
+		t.Errorf("Invalid dup:\"first\" result: %v %v", err, first.Items)
+	}
+
+	_, err = Parse(&d, []byte(`{"a": 1,}`), nil)
+	if err == nil {
+		t.Errorf("Trailing delimiter was accepted")
+	}
+
+	RegisterType("opToken", opToken{})
+
+	var m mapDelimiters
+	_, err = Parse(&m, []byte(`"a": 1; "b": 2, "c": 3 | "x" = 1 + "y" = 2 - "z" = 3`), nil)
+	if err != nil || len(m.Rx) != 3 || len(m.Tp) != 3 || len(m.TpD) != 2 || m.TpD[0].Op != "+" || m.TpD[1].Op != "-" {
+		t.Fatalf("Invalid result: %v %v", m, err)
+	}
+
+	res, err = Append(nil, m)
+	if err != nil || string(res) != `"a":1;"b":2;"c":3|"x"=1+"y"=2-"z"=3` {
+		t.Fatalf("Invalid output: %s %v", string(res), err)
+	}
+
+	var m2 mapDelimiters
+	_, err = Parse(&m2, res, nil)
+	if err != nil || !reflect.DeepEqual(m, m2) {
+		t.Errorf("Output was not parsed back: %v %v", m2, err)
+	}
+
+	_, err = Parse(&m, []byte(`"a": 1 | "x" = 1 + "y" = 2 +`), nil)
+	if err != nil || len(m.TpD) != 1 {
+		t.Errorf("Delimiter after the last entry was saved: %v %v", m, err)
+	}
+}
+
+type mapDelimiters struct {
+	Rx  map[string]int `kv:":" delimiterRegexp:"[,;]" delimiterWrite:";"`
+	_   string         `literal:"|"`
+	Tp  map[string]int `delimiterType:"opToken" delimiters:"TpD" parse:"+"`
+	TpD []opToken
+}
+
+type altStmt interface {
+	isStmt()
+}
+
+type altIf struct {
+	_    string    `literal:"if"`
+	Cond string    `regexp:"[a-z]+"`
+	_    string    `literal:"{"`
+	Body []altStmt `delimiter:";"`
+	_    string    `literal:"}"`
+}
+
+type altPrint struct {
+	_   string `literal:"print"`
+	Arg string `regexp:"[a-z]+"`
+}
+
+type altAssign struct {
+	Name  string `regexp:"[a-z]+"`
+	_     string `literal:"="`
+	Value int
+}
+
+func (altIf) isStmt()      {}
+func (altPrint) isStmt()   {}
+func (*altAssign) isStmt() {}
+
+type altExpr interface{}
+
+type altSub struct {
+	Left  altExpr
+	_     string `literal:"-"`
+	Right int
+}
+
+func init() {
+	RegisterAlternatives[altStmt](altIf{}, altPrint{}, &altAssign{})
+	RegisterAlternatives[altExpr](altSub{}, 0)
+}
+
+func TestAlternatives(t *testing.T) {
+	var prog []altStmt
+	src := "if a { print b; c = 1 } print d"
+	l, err := Parse(&prog, []byte(src), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if l != len(src) || len(prog) != 2 {
+		t.Fatalf("Invalid result (%d): %v", l, prog)
+	}
+
+	st, ok := prog[0].(altIf)
+	if !ok || st.Cond != "a" || len(st.Body) != 2 {
+		t.Fatalf("Invalid if statement: %#v", prog[0])
+	}
+
+	if p, ok := st.Body[0].(altPrint); !ok || p.Arg != "b" {
+		t.Errorf("Invalid print statement: %#v", st.Body[0])
+	}
+
+	if a, ok := st.Body[1].(*altAssign); !ok || a.Name != "c" || a.Value != 1 {
+		t.Errorf("Invalid assignment: %#v", st.Body[1])
+	}
+
+	res, err := Append(nil, prog)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if string(res) != "ifa{printb;c=1}printd" {
+		t.Errorf("Invalid output: %s", string(res))
+	}
+
+	var e altExpr
+	src = "5 - 2 - 1"
+	l, err = Parse(&e, []byte(src), nil)
+	if err != nil || l != len(src) {
+		t.Fatalf("Parse of left recursive alternatives failed (%d): %v", l, err)
+	}
+
+	sub, ok := e.(altSub)
+	if !ok || sub.Right != 1 {
+		t.Fatalf("Invalid expression: %#v", e)
+	}
+
+	if left, ok := sub.Left.(altSub); !ok || left.Right != 2 || left.Left != 5 {
+		t.Errorf("Invalid left operand: %#v", sub.Left)
+	}
+}
+
+type inlineName struct {
+	Name string `regexp:"[a-z]+"`
+}
+
+type InlineType struct {
+	_    string `literal:":"`
+	Type string `regexp:"[a-z]+"`
+}
+
+type InlineDefault struct {
+	_     string `literal:"="`
+	Value int
+}
+
+type inlineVar struct {
+	_ string `literal:"var"`
+	inlineName
+	*InlineType
+	*InlineDefault
+	_ string `literal:";"`
+}
+
+type inlineValue struct {
+	Num int
+	FirstOf
+	Str string
+}
+
+type inlineParam struct {
+	inlineName
+	_ string `literal:"="`
+	inlineValue
+}
+
+func TestInline(t *testing.T) {
+	var vars []inlineVar
+	src := "var a : int = 1; var b; var c = 2;"
+	l, err := Parse(&vars, []byte(src), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if l != len(src) || len(vars) != 3 {
+		t.Fatalf("Invalid result (%d): %v", l, vars)
+	}
+
+	if vars[0].Name != "a" || vars[0].InlineType == nil || vars[0].Type != "int" || vars[0].InlineDefault == nil || vars[0].Value != 1 {
+		t.Errorf("Invalid first variable: %v", vars[0])
+	}
+
+	if vars[1].Name != "b" || vars[1].InlineType != nil || vars[1].InlineDefault != nil {
+		t.Errorf("Invalid second variable: %v", vars[1])
+	}
+
+	if vars[2].Name != "c" || vars[2].InlineType != nil || vars[2].InlineDefault == nil || vars[2].Value != 2 {
+		t.Errorf("Invalid third variable: %v", vars[2])
+	}
+
+	res, err := Append(nil, vars)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if string(res) != "vara:int=1;varb;varc=2;" {
+		t.Errorf("Invalid output: %s", string(res))
+	}
+
+	var p inlineParam
+	src = `x = "abc"`
+	l, err = Parse(&p, []byte(src), nil)
+	if err != nil || l != len(src) {
+		t.Fatalf("Parse failed (%d): %v", l, err)
+	}
+
+	if p.Name != "x" || p.FirstOf.Field != "Str" || p.Str != "abc" {
+		t.Errorf("Invalid result: %v", p)
+	}
+
+	res, err = Append(nil, p)
+	if err != nil || string(res) != `x="abc"` {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+}
+
+type rawCall struct {
+	Name string `regexp:"[a-z]+"`
+	_    string `literal:"("`
+	Args []int  `delimiter:","`
+	_    string `literal:")"`
+}
+
+type rawDoc struct {
+	Quoted string `parse:"raw"`
+	Bytes  []byte `parse:"raw" regexp:"[0-9]+"`
+	Call   Raw[rawCall]
+	Calls  []Raw[rawCall] `delimiter:";"`
+}
+
+func TestRaw(t *testing.T) {
+	var d rawDoc
+	src := "\"a\\tb\" 0123 f( 1,2 ) g(3) ; h( )"
+	l, err := Parse(&d, []byte(src), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if l != len(src) || d.Quoted != "\"a\\tb\"" || string(d.Bytes) != "0123" {
+		t.Fatalf("Invalid result (%d): %v", l, d)
+	}
+
+	if d.Call.Text != "f( 1,2 )" || d.Call.Value.Name != "f" || len(d.Call.Value.Args) != 2 {
+		t.Errorf("Invalid raw value: %v", d.Call)
+	}
+
+	if len(d.Calls) != 2 || d.Calls[0].Text != "g(3)" || d.Calls[1].Text != "h( )" {
+		t.Errorf("Invalid raw list: %v", d.Calls)
+	}
+
+	d.Calls[1].Text = ""
+	d.Calls[1].Value.Args = []int{4}
+	res, err := Append(nil, d)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if string(res) != "\"a\\tb\"0123f( 1,2 )g(3);h(4)" {
+		t.Errorf("Invalid output: %s", string(res))
+	}
+	// Comments skipped after the value are not a part of the text:
+	skip := func(str []byte, loc int) int {
+		return SkipAll(str, loc, SkipSpaces, SkipCComment)
+	}
+	for _, packrat := range []bool{false, true} {
+		src = "\"\" 1 f(1) /* f */ g( 2 /* 2 */ ) /* g */ ; h() /* h */"
+		_, err = Parse(&d, []byte(src), &Options{SkipWhite: skip, PackratEnabled: packrat})
+		if err != nil || d.Call.Text != "f(1)" || len(d.Calls) != 2 || d.Calls[0].Text != "g( 2 /* 2 */ )" ||
+			d.Calls[1].Text != "h()" {
+			t.Errorf("Invalid raw values with comments: %v %v %v", d.Call, d.Calls, err)
+		}
+	}
+}
+
+type charsIdent struct {
+	First rune   `chars:"a-zA-Z_" unicode:"L"`
+	Rest  string `chars:"a-zA-Z0-9_" unicode:"L,Nd" min:"0"`
+}
+
+type charsCode struct {
+	Code  string `chars:"A-Z" min:"2" max:"3"`
+	Digit string `chars:"0-9"`
+	Other string `chars:"^;" min:"0"`
+	_     string `literal:";"`
+}
+
+func TestChars(t *testing.T) {
+	var id charsIdent
+	src := "привет_1٣"
+	l, err := Parse(&id, []byte(src), nil)
+	if err != nil || l != len(src) || id.First != 'п' || id.Rest != "ривет_1٣" {
+		t.Errorf("Invalid identifier (%d): %v %v", l, id, err)
+	}
+
+	_, err = Parse(&id, []byte("1a"), nil)
+	if err == nil || !strings.Contains(err.Error(), "[a-zA-Z_] or Unicode L") {
+		t.Errorf("Invalid error: %v", err)
+	}
+
+	var c charsCode
+	src = "ABCD1x y;"
+	_, err = Parse(&c, []byte(src), nil)
+	if err == nil {
+		t.Errorf("Parsed too long code")
+	}
+
+	src = "ABC12 x;"
+	l, err = Parse(&c, []byte(src), nil)
+	if err != nil || l != len(src) || c.Code != "ABC" || c.Digit != "12" || c.Other != "x" {
+		t.Errorf("Invalid result (%d): %v %v", l, c, err)
+	}
+
+	_, err = Parse(&c, []byte("A1;"), nil)
+	if err == nil || !strings.Contains(err.Error(), "at least 2 characters of [A-Z]") {
+		t.Errorf("Invalid error: %v", err)
+	}
+
+	res, err := Append(nil, c)
+	if err != nil || string(res) != "ABC12x;" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	c.Code = "abc"
+	_, err = Append(nil, c)
+	if err == nil {
+		t.Errorf("Written invalid characters")
+	}
+}
+
+type combKeyword struct {
+	Word string `regexp:"(let|in)\\b"`
+}
+
+type combIdent struct {
+	Not[combKeyword]
+	Name string `regexp:"[a-z]+"`
+}
+
+type combComma struct {
+	_ string `literal:","`
+}
+
+type combLet struct {
+	_     string `literal:"let"`
+	Names SepBy[Many1[combIdent], combComma]
+	_     string `literal:"in"`
+	Body  Opt[combIdent]
+	Next  And[combComma]
+}
+
+type combNames struct {
+	Names Many1[combIdent]
+}
+
+type combEmpty struct {
+	Opts  Many[Opt[combIdent]]
+	Lists Many[SepBy[combIdent, combComma]]
+	Map   map[Opt[combIdent]]Opt[combIdent] `kv:""`
+	_     string                            `literal:";"`
+}
+
+func TestCombinators(t *testing.T) {
+	var v combLet
+	src := "let a b, c in d,"
+	l, err := Parse(&v, []byte(src), nil)
+	if err != nil || l != len(src)-1 {
+		t.Fatalf("Parse failed (%d): %v", l, err)
+	}
+
+	if len(v.Names.Items) != 2 || len(v.Names.Items[0]) != 2 || v.Names.Items[1][0].Name != "c" || len(v.Names.Seps) != 1 {
+		t.Errorf("Invalid names: %v", v.Names)
+	}
+
+	if v.Body.Value == nil || v.Body.Value.Name != "d" {
+		t.Errorf("Invalid body: %v", v.Body)
+	}
+
+	res, err := Append(nil, v)
+	if err != nil || string(res) != "letab,cind" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	var names combNames
+	_, err = Parse(&names, []byte("in"), nil)
+	if err == nil {
+		t.Errorf("Empty Many1 was accepted")
+	}
+
+	src = "let a in ,"
+	l, err = Parse(&v, []byte(src), nil)
+	if err != nil || v.Body.Value != nil {
+		t.Errorf("Invalid optional value (%d): %v %v", l, v.Body, err)
+	}
+
+	src = "let a in b"
+	_, err = Parse(&v, []byte(src), nil)
+	if err == nil {
+		t.Errorf("Lookahead was not checked")
+	}
+	// Lists of elements matching empty string end at the first empty element:
+	var e combEmpty
+	src = "a b;"
+	l, err = Parse(&e, []byte(src), nil)
+	if err != nil || l != len(src) || len(e.Opts) != 2 || e.Opts[1].Value.Name != "b" || len(e.Lists) != 0 {
+		t.Errorf("Invalid list of optional values (%d): %v %v", l, e, err)
+	}
+
+	var lists combEmpty
+	src = ";"
+	l, err = Parse(&lists, []byte(src), nil)
+	if err != nil || l != len(src) || len(lists.Opts) != 0 || len(lists.Lists) != 0 || len(lists.Map) != 0 {
+		t.Errorf("Invalid empty lists (%d): %v %v", l, lists, err)
+	}
+}
+
+type checkNumber struct {
+	FirstOf
+	Small int    `check:"IsSmall"`
+	Word  string `regexp:"[0-9a-z]+" check:"IsWord"`
+}
+
+func (n checkNumber) IsSmall(v int) bool {
+	return v < 100
+}
+
+func (n checkNumber) IsWord(v string) error {
+	if v == "bad" {
+		return errors.New("bad word")
+	}
+
+	return nil
+}
+
+type checkWord struct {
+	Word string `regexp:"[a-z]+" check:"IsWord"`
+}
+
+func (checkWord) IsWord(v string) error {
+	return checkNumber{}.IsWord(v)
+}
+
+type setPort struct {
+	Name string `regexp:"[a-z]+"`
+	_    string `literal:":"`
+	Port int    `set:"SetPort"`
+}
+
+var errPortRange = errors.New("port is out of range")
+
+func (p *setPort) SetPort(v int) error {
+	if v > 65535 {
+		return errPortRange
+	}
+
+	return nil
+}
+
+type setPorts struct {
+	FirstOf
+	Port *setPort
+	Any  string `regexp:".*"`
+}
+
+type setPortOrNumber struct {
+	FirstOf
+	Port   *setPort
+	Number int
+}
+
+func TestCheckAndSet(t *testing.T) {
+	var n checkNumber
+	_, err := Parse(&n, []byte("42"), nil)
+	if err != nil || n.FirstOf.Field != "Small" || n.Small != 42 {
+		t.Errorf("Invalid result: %v %v", n, err)
+	}
+
+	_, err = Parse(&n, []byte("420"), nil)
+	if err != nil || n.FirstOf.Field != "Word" || n.Word != "420" {
+		t.Errorf("Check didn't reject value: %v %v", n, err)
+	}
+
+	_, err = Parse(&n, []byte("bad"), nil)
+	if err == nil {
+		t.Errorf("Check didn't reject value: %v", n)
+	}
+
+	var w checkWord
+	_, err = Parse(&w, []byte("bad"), nil)
+	if err == nil || !strings.Contains(err.Error(), "bad word") {
+		t.Errorf("Invalid error: %v", err)
+	}
+
+	// Failed set is ordinary failure, so the next alternative is tried:
+	var p setPorts
+	src := "http:  80800 "
+	_, err = Parse(&p, []byte(src), nil)
+	if err != nil || p.Field != "Any" || p.Any != "http:  80800 " {
+		t.Errorf("Next alternative was not tried: %v %v", p, err)
+	}
+
+	_, err = Parse(&p, []byte("http: 80"), nil)
+	if err != nil || p.Field != "Port" || p.Port.Port != 80 {
+		t.Errorf("Invalid result: %v %v", p, err)
+	}
+
+	var port setPort
+	_, err = Parse(&port, []byte(src), nil)
+	if err == nil {
+		t.Fatalf("Set error was ignored: %v", port)
+	}
+
+	var setErr *SetError
+	if !errors.As(err, &setErr) || !errors.Is(err, errPortRange) {
+		t.Fatalf("Invalid error type: %v", err)
+	}
+
+	if setErr.Method != "SetPort" || setErr.Field != "Port" || src[setErr.Start:setErr.End] != "80800" {
+		t.Errorf("Invalid set error: %v", setErr)
+	}
+
+	if perr, ok := err.(Error); !ok || perr.Location != setErr.Start {
+		t.Errorf("Invalid error location: %v", err)
+	}
+	// Cause of the furthest error is kept when all alternatives fail:
+	for _, packrat := range []bool{false, true} {
+		var pn setPortOrNumber
+		_, err = Parse(&pn, []byte(src), &Options{SkipWhite: SkipSpaces, PackratEnabled: packrat})
+		if !errors.As(err, &setErr) || setErr.Field != "Port" {
+			t.Errorf("Invalid error of alternatives: %v", err)
+		}
+	}
+}
+
+type refHeredoc struct {
+	_     string `literal:"<<"`
+	Tag   string `regexp:"[A-Z]+"`
+	Body  string `until:"Tag"`
+	End   string `match:"Tag"`
+	Token string `regexp:"[a-z]+"`
+}
+
+type refElement struct {
+	_     string `literal:"<"`
+	Name  string `regexp:"[a-z]+"`
+	_     string `literal:">"`
+	Items []refItem
+	_     string `literal:"</"`
+	_     string `match:"Name"`
+	_     string `literal:">"`
+}
+
+type refItem struct {
+	FirstOf
+	Element *refElement
+	Text    string `regexp:"[^<]+"`
+}
+
+func TestBackReferences(t *testing.T) {
+	var h refHeredoc
+	_, err := Parse(&h, []byte("<<EOF\nline 1\nline 2\nEOF done"), nil)
+	if err != nil || h.Tag != "EOF" || h.Body != "line 1\nline 2\n" || h.End != "EOF" || h.Token != "done" {
+		t.Errorf("Invalid result: %#v %v", h, err)
+	}
+
+	_, err = Parse(&h, []byte("<<EOF\nline 1\nEND done"), nil)
+	if err == nil || !strings.Contains(err.Error(), "EOF") {
+		t.Errorf("Missing terminator wasn't reported: %v", err)
+	}
+
+	var e refElement
+	_, err = Parse(&e, []byte("<a>x<b>y</b><c></c></a>"), nil)
+	if err != nil || e.Name != "a" || len(e.Items) != 3 || e.Items[1].Element.Name != "b" || e.Items[2].Element.Name != "c" {
+		t.Fatalf("Invalid result: %v %v", e, err)
+	}
+
+	res, err := Append(nil, &e)
+	if err != nil || string(res) != "<a>x<b>y</b><c></c></a>" {
+		t.Errorf("Invalid output: %q %v", string(res), err)
+	}
+
+	_, err = Parse(&e, []byte("<a><b></a></b>"), nil)
+	if err == nil {
+		t.Errorf("Mismatched tags were parsed: %v", e)
+	}
+
+	h = refHeredoc{Tag: "END", Body: "text END\n", Token: "x"}
+	res, err = Append(nil, &h)
+	if err == nil {
+		t.Errorf("Terminator inside of body was written: %q", string(res))
+	}
+}
+
+type stTypedef struct {
+	_    string `literal:"typedef"`
+	Type string `regexp:"[a-z]+"`
+	Name string `regexp:"[a-z]+" set:"AddType"`
+	_    string `literal:";"`
+}
+
+func (stTypedef) AddType(name string, state interface{}) (interface{}, error) {
+	types, _ := state.(map[string]bool)
+	res := map[string]bool{name: true}
+	for t := range types {
+		res[t] = true
+	}
+	return res, nil
+}
+
+type stVar struct {
+	Type string `regexp:"[a-z]+" check:"IsType"`
+	Name string `regexp:"[a-z]+"`
+	_    string `literal:";"`
+}
+
+func (stVar) IsType(name string, state interface{}) bool {
+	types, _ := state.(map[string]bool)
+	return types[name]
+}
+
+type stCall struct {
+	Name string `regexp:"[a-z]+"`
+	_    string `literal:"("`
+	Arg  string `regexp:"[a-z]+"`
+	_    string `literal:")"`
+	_    string `literal:";"`
+}
+
+type stStmt struct {
+	FirstOf
+	Typedef *stTypedef
+	Var     *stVar
+	Call    *stCall
+}
+
+type stProgram struct {
+	Stmts []stStmt
+	_     EOL
+}
+
+type stMark struct{}
+
+func (m *stMark) ParseValue(buf []byte, loc int, state interface{}) (int, interface{}, error) {
+	if loc >= len(buf) || buf[loc] != '#' {
+		return -1, nil, errors.New("Waiting for #")
+	}
+
+	n, _ := state.(int)
+	return loc + 1, n + 1, nil
+}
+
+func (m stMark) WriteValue(out io.Writer) error {
+	_, err := out.Write([]byte("#"))
+	return err
+}
+
+type stMarksBad struct {
+	Marks []stMark
+	_     string `literal:"!"`
+}
+
+type stMarks struct {
+	FirstOf
+	Bad  *stMarksBad
+	Good []stMark
+}
+
+func TestState(t *testing.T) {
+	for _, packrat := range []bool{false, true} {
+		var prog stProgram
+		opts := &Options{SkipWhite: SkipSpaces, PackratEnabled: packrat, State: map[string]bool{"int": true}}
+		_, state, err := ParseWithState(&prog, []byte("int a; typedef int t; t x; f(x); t y;"), opts)
+		if err != nil || len(prog.Stmts) != 5 || prog.Stmts[2].Var == nil || prog.Stmts[3].Call == nil || prog.Stmts[4].Var == nil {
+			t.Errorf("Invalid result: %v %v", prog, err)
+		}
+
+		if types, ok := state.(map[string]bool); !ok || !types["t"] || !types["int"] {
+			t.Errorf("Invalid final state: %v", state)
+		}
+
+		// Options are not changed, so they could be used again:
+		if types := opts.State.(map[string]bool); len(types) != 1 {
+			t.Errorf("Options were changed: %v", opts.State)
+		}
+
+		_, err = Parse(&prog, []byte("t x;"), opts)
+		if err == nil {
+			t.Errorf("Type from the previous parsing was used: %v", prog)
+		}
+
+		opts = &Options{SkipWhite: SkipSpaces, PackratEnabled: packrat}
+		_, err = Parse(&prog, []byte("t x; typedef int t;"), opts)
+		if err == nil {
+			t.Errorf("Type was used before typedef: %v", prog)
+		}
+
+		var marks stMarks
+		opts = &Options{SkipWhite: SkipSpaces, PackratEnabled: packrat, State: 10}
+		_, state, err = ParseWithState(&marks, []byte("###"), opts)
+		if err != nil || len(marks.Good) != 3 || state != 13 || opts.State != 10 {
+			t.Errorf("State was not restored on backtracking: %v %v %v", marks, state, err)
+		}
+	}
+}
+
+type ctxNumber struct {
+	Value int
+}
+
+type ctxList struct {
+	Items []ctxNumber
+}
+
+func (lst *ctxList) ParseValue(ctx *Context, loc int) (int, error) {
+	buf := ctx.Buffer()
+	if loc >= len(buf) || buf[loc] != '[' {
+		return -1, ctx.Errorf(loc, "Waiting for [")
+	}
+
+	lst.Items = nil
+	loc = ctx.SkipWS(loc + 1)
+	for loc < len(buf) && buf[loc] != ']' {
+		var n ctxNumber
+		next, err := ctx.ParseInto(&n, loc)
+		if err != nil {
+			return -1, err
+		}
+
+		lst.Items = append(lst.Items, n)
+		loc = next
+		if loc < len(buf) && buf[loc] == ';' {
+			loc = ctx.SkipWS(loc + 1)
+		}
+	}
+
+	if loc >= len(buf) {
+		return -1, ctx.Errorf(loc, "Waiting for ]")
+	}
+
+	return loc + 1, nil
+}
+
+func (lst *ctxList) WriteValue(out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%v", lst.Items)
+	return err
+}
+
+type ctxSub struct {
+	Left  *ctxExpr
+	_     string `literal:"-"`
+	Right int
+}
+
+type ctxExpr struct {
+	Sub *ctxSub
+	Num int
+}
+
+func (e *ctxExpr) ParseValue(ctx *Context, loc int) (int, error) {
+	var sub ctxSub
+	if l, err := ctx.ParseInto(&sub, loc); err == nil {
+		e.Sub = &sub
+		return l, nil
+	}
+
+	e.Sub = nil
+	return ctx.ParseInto(&e.Num, loc)
+}
+
+func (e *ctxExpr) WriteValue(out io.Writer) error {
+	_, err := fmt.Fprint(out, e.eval())
+	return err
+}
+
+func (e *ctxExpr) eval() int {
+	if e.Sub != nil {
+		return e.Sub.Left.eval() - e.Sub.Right
+	}
+	return e.Num
+}
+
+type ctxProgram struct {
+	List ctxList
+	Expr ctxExpr
+}
+
+func TestContextParser(t *testing.T) {
+	for _, packrat := range []bool{false, true} {
+		var prog ctxProgram
+		opts := &Options{SkipWhite: SkipSpaces, PackratEnabled: packrat}
+		_, err := Parse(&prog, []byte("[ 1; 2 ;3 ] 10 - 2 - 3"), opts)
+		if err != nil || len(prog.List.Items) != 3 || prog.List.Items[2].Value != 3 {
+			t.Fatalf("Invalid result: %v %v", prog, err)
+		}
+
+		if prog.Expr.eval() != 5 || prog.Expr.Sub == nil || prog.Expr.Sub.Right != 3 {
+			t.Errorf("Invalid left recursive expression: %v", prog.Expr.eval())
+		}
+
+		_, err = Parse(&prog, []byte("[ 1; x ] 1"), opts)
+		if e, ok := err.(Error); !ok || e.Location != 5 {
+			t.Errorf("Invalid error: %v", err)
+		}
+
+		_, err = Parse(&prog, []byte("[ 1; 2 "), opts)
+		if err == nil || !strings.Contains(err.Error(), "Waiting for ]") {
+			t.Errorf("Invalid error: %v", err)
+		}
+	}
+	// Parsers used by ParseInto are compiled once:
+	if _, ok := _contextParsers.Load(reflect.TypeOf(ctxSub{})); !ok {
+		t.Errorf("Parser of %v is not cached", reflect.TypeOf(ctxSub{}))
+	}
+}
+
+// Parser writing directly into bytes.Buffer
+type bufWord struct {
+	Word string
+}
+
+func (w *bufWord) ParseValue(buf []byte, loc int) (int, error) {
+	l := loc
+	for l < len(buf) && buf[l] >= 'a' && buf[l] <= 'z' {
+		l++
+	}
+
+	w.Word = string(buf[loc:l])
+	return l, nil
+}
+
+func (w *bufWord) WriteValue(out io.Writer) error {
+	buf, ok := out.(*bytes.Buffer)
+	if !ok {
+		return fmt.Errorf("Invalid writer %T", out)
+	}
+
+	_, err := buf.WriteString(w.Word)
+	return err
+}
+
+func TestUserWriter(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, &struct {
+		A bufWord
+		_ string `literal:","`
+		B bufWord
+	}{A: bufWord{"a"}, B: bufWord{"b"}})
+	if err != nil || buf.String() != "a,b" {
+		t.Errorf("Invalid output: %s %v", buf.String(), err)
+	}
+}
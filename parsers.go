@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -121,48 +124,83 @@ func (par *nonTerminal) IsTerm() bool {
 	return false
 }
 
-// Parser for Go-like boolean values.
-// Value is 'true' or 'false' with following character from [^a-zA-Z0-9_]
+// Parser for boolean values. Value is one of spellings. As for 'true' and 'false' spelling ending with identifier
+// character must be followed by character from [^a-zA-Z0-9_], so 'trueish' is not a boolean value.
+// Default spelling is 'true' or 'false'.
 type boolParser struct {
 	idHolder
 	terminal
+	// Spellings of true and false values or nil for the default spellings
+	Pairs []boolPair
+}
+
+// Spelling of true and false values.
+type boolPair struct {
+	True  string
+	False string
 }
 
 var boolError = "Waiting for boolean value"
 
+var _defaultBoolPairs = []boolPair{{"true", "false"}}
+
+// Parse spellings of boolean values: "yes/no,on/off".
+func parseBoolPairs(spec string) ([]boolPair, error) {
+	var res []boolPair
+	for _, pair := range strings.Split(spec, ",") {
+		values := strings.Split(strings.TrimSpace(pair), "/")
+		if len(values) != 2 || values[0] == "" || values[1] == "" {
+			return nil, fmt.Errorf("Invalid spelling of boolean values `%s': waiting for true/false pair", pair)
+		}
+
+		res = append(res, boolPair{values[0], values[1]})
+	}
+
+	return res, nil
+}
+
 func (par *boolParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
-	if strAt(ctx.str, location, "true") {
-		valueOf.SetBool(true)
-		location += 4
-	} else if strAt(ctx.str, location, "false") {
-		valueOf.SetBool(false)
-		location += 5
-	} else {
+	pairs := par.Pairs
+	if pairs == nil {
+		pairs = ctx.bools
+	}
+
+	// Find the longest spelling:
+	l := -1
+	v := false
+	for _, p := range pairs {
+		for _, spelling := range []string{p.True, p.False} {
+			if len(spelling) > l && ctx.operatorAt(location, spelling) {
+				l = len(spelling)
+				v = spelling == p.True
+			}
+		}
+	}
+
+	if l < 0 {
 		err.Location = location
 		err.Message = boolError
 		return -1
 	}
 
-	if location < len(ctx.str) {
-		if ctx.str[location] == '_' ||
-			(ctx.str[location] >= 'a' && ctx.str[location] <= 'z') ||
-			(ctx.str[location] >= 'A' && ctx.str[location] <= 'Z') ||
-			(ctx.str[location] >= '0' && ctx.str[location] <= '9') {
-			err.Location = location
-			err.Message = boolError
-			return -1
-		}
-	}
+	valueOf.SetBool(v)
 
-	return location
+	return location + l
 }
 
 func (par *boolParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	p := _defaultBoolPairs[0]
+	if par.Pairs != nil {
+		p = par.Pairs[0]
+	} else if w, ok := out.(*indentWriter); ok && w.bools != nil {
+		p = w.bools[0]
+	}
+
 	var err error
 	if valueOf.Bool() {
-		_, err = out.Write([]byte("true"))
+		_, err = out.Write([]byte(p.True))
 	} else {
-		_, err = out.Write([]byte("false"))
+		_, err = out.Write([]byte(p.False))
 	}
 
 	return err
@@ -218,10 +256,11 @@ func newRegexpParser(rx string) (parser, error) {
 	return &regexpParser{Regexp: r, err: msg}, nil
 }
 
-// Go string parser.
+// String literal parser.
 type stringParser struct {
 	idHolder
 	terminal
+	Dialect *stringDialect
 }
 
 // Parse Go unicode value:
@@ -361,6 +400,12 @@ func (ctx *parseContext) parseString(location int, err *Error) (string, int) {
 
 	*/
 
+	if location >= len(ctx.str) {
+		err.Message = "Unexpected end of file. Waiting for Go string"
+		err.Location = location
+		return "", -1
+	}
+
 	if ctx.str[location] == '`' { // raw string
 		for location++; location < len(ctx.str); {
 			if ctx.str[location] == '`' { // End of string
@@ -404,7 +449,7 @@ func (ctx *parseContext) parseString(location int, err *Error) (string, int) {
 }
 
 func (par *stringParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
-	s, nl := ctx.parseString(location, err)
+	s, nl := par.Dialect.parse(ctx, location, err)
 	if nl < 0 {
 		return nl
 	}
@@ -415,7 +460,7 @@ func (par *stringParser) ParseValue(ctx *parseContext, valueOf reflect.Value, lo
 }
 
 func (par *stringParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
-	_, err := out.Write(strconv.AppendQuote(nil, valueOf.String()))
+	_, err := out.Write([]byte(par.Dialect.quote(valueOf.String())))
 	return err
 }
 
@@ -456,195 +501,112 @@ func newLiteralParser(lit string) parser {
 	return &literalParser{Literal: lit, msg: msg}
 }
 
-// Check if there was overflow for <size> bits type
-func (ctx *parseContext) checkUintOverflow(v uint64, location int, size uint) bool {
-	if size >= 64 {
-		return false
+// Find number matched by regular expression of the dialect and remove suffix.
+// Returns matched text, text without suffix and location after the number.
+func (ctx *parseContext) findNumber(location int, rx *regexp.Regexp, d *numberDialect, suffix string, err *Error) (string, int) {
+	m := rx.Find(ctx.str[location:])
+	if m == nil {
+		return "", -1
 	}
 
-	if (v >> size) != 0 {
-		return true
+	l := location + len(m)
+	if d.noLeadingZeros && l < len(ctx.str) && ctx.str[l] >= '0' && ctx.str[l] <= '9' {
+		err.Message = "Leading zeros are not allowed"
+		err.Location = location
+		return "", -1
 	}
 
-	return false
+	return strings.TrimRight(string(m), suffix), l
 }
 
-// Parse uint value and save it in uint64.
-// size is value size in bits.
-func (ctx *parseContext) parseUint64(location int, size uint, err *Error) (uint64, int) {
-	if location >= len(ctx.str) {
-		err.Message = "Unexpected end of file. Waiting for integer literal."
-		err.Location = location
-		return 0, -1
+// Set error message for strconv error.
+func numberError(e error, kind string, location int, err *Error) {
+	if errors.Is(e, strconv.ErrRange) {
+		err.Message = kind + " overflow"
+	} else {
+		err.Message = "Invalid " + strings.ToLower(kind) + " literal"
 	}
+	err.Location = location
+}
 
-	var res uint64
-	if ctx.str[location] == '0' {
-		if location+1 < len(ctx.str) && (ctx.str[location+1] == 'x' || ctx.str[location+1] == 'X') { // HEX
-			location += 2
-
-			if location >= len(ctx.str) {
-				err.Message = "Unexpected end of file in hexadecimal literal."
-				err.Location = location
-				return 0, -1
-			}
-
-			for ; location < len(ctx.str); location++ {
-				if (res & 0xf000000000000000) != 0 {
-					err.Message = "Integer overflow"
-					err.Location = location
-					return 0, -1
-				}
-
-				if (ctx.str[location] >= '0') && (ctx.str[location] <= '9') {
-					res = (res << 4) + uint64(ctx.str[location]-'0')
-				} else if (ctx.str[location] >= 'a') && (ctx.str[location] <= 'f') {
-					res = (res << 4) + uint64(ctx.str[location]-'a') + 10
-				} else if (ctx.str[location] >= 'A') && (ctx.str[location] <= 'F') {
-					res = (res << 4) + uint64(ctx.str[location]-'A') + 10
-				} else {
-					break
-				}
-			}
-
-			if ctx.checkUintOverflow(res, location, size) {
-				err.Message = "Integer overflow"
-				err.Location = location
-				return 0, -1
-			}
-
-			return res, location
-		}
-
-		// OCT
-		for ; location < len(ctx.str); location++ {
-			if (res & 0xe000000000000000) != 0 {
-				err.Message = "Integer overflow"
-				err.Location = location
-				return 0, -1
-			}
-
-			if ctx.str[location] >= '0' && ctx.str[location] <= '7' {
-				res = (res << 3) + uint64(ctx.str[location]-'0')
-			} else {
-				break
-			}
-		}
-
-		if ctx.checkUintOverflow(res, location, size) {
-			err.Message = "Integer overflow"
-			err.Location = location
-			return 0, -1
-		}
-
-		return res, location
-	} else if ctx.str[location] > '0' && ctx.str[location] <= '9' {
-		var r8 uint64
-		for ; location < len(ctx.str); location++ {
-			if (res & 0xe000000000000000) != 0 {
-				err.Message = "Integer overflow"
-				err.Location = location
-				return 0, -1
-			}
-
-			if ctx.str[location] >= '0' && ctx.str[location] <= '9' {
-				r8 = res << 3 // r8 = res * 8 Here could not be overflow: we have checked this before
-				res = r8 + (res << 1)
-				if res < r8 { // Overflow!
-					err.Message = "Integer overflow"
-					err.Location = location
-					return 0, location
-				}
+// Parse uint value and save it in uint64.
+// size is value size in bits.
+func (ctx *parseContext) parseUint64(location int, size uint, d *numberDialect, err *Error) (uint64, int) {
+	err.Message = "Waiting for integer literal"
+	err.Location = location
 
-				res += uint64(ctx.str[location] - '0')
-			} else {
-				break
-			}
-		}
+	s, l := ctx.findNumber(location, d.uintRe, d, d.intSuffix, err)
+	if l < 0 {
+		return 0, l
+	}
 
-		if ctx.checkUintOverflow(res, location, size) {
-			err.Message = "Integer overflow"
-			err.Location = location
-			return 0, -1
-		}
+	// ParseUint doesn't accept sign:
+	s = strings.TrimPrefix(s, "+")
 
-		return res, location
+	res, e := strconv.ParseUint(s, d.base, int(size))
+	if e != nil {
+		numberError(e, "Integer", location, err)
+		return 0, -1
 	}
 
-	err.Message = "Waiting for integer literal"
-	err.Location = location
-	return 0, -1
+	return res, l
 }
 
 // Parse int value and save it in int64.
 // size is value size in bits.
-func (ctx *parseContext) parseInt64(location int, size uint, err *Error) (int64, int) {
-	neg := false
-	if location >= len(ctx.str) {
-		err.Message = "Unexpected end of file. Waiting for integer."
-		return 0, -1
-	}
-
-	if ctx.str[location] == '-' {
-		neg = true
-		location++
-
-		/* TODO: allow spaces after '-'??? */
-	}
+func (ctx *parseContext) parseInt64(location int, size uint, d *numberDialect, err *Error) (int64, int) {
+	err.Message = "Waiting for integer literal"
+	err.Location = location
 
-	v, l := ctx.parseUint64(location, size, err)
+	s, l := ctx.findNumber(location, d.intRe, d, d.intSuffix, err)
 	if l < 0 {
 		return 0, l
 	}
 
-	if (v & 0x8000000000000000) != 0 {
-		err.Message = "Integer overflow"
-		err.Location = location
-		return 0, location
-	}
-
-	res := int64(v)
-	if neg {
-		res = -res
+	res, e := strconv.ParseInt(s, d.base, int(size))
+	if e != nil {
+		numberError(e, "Integer", location, err)
+		return 0, -1
 	}
 
 	return res, l
 }
 
-var floatRegexp = regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]+)?|\.[0-9]+)([eE][-+]?[0-9]+)?`)
-
-func (ctx *parseContext) parseFloat(location int, size int, err *Error) (float64, int) {
-	m := floatRegexp.Find(ctx.str[location:])
+func (ctx *parseContext) parseFloat(location int, size int, d *numberDialect, err *Error) (float64, int) {
+	err.Message = "Waiting for floating point number"
+	err.Location = location
 
-	if m == nil {
-		err.Message = "Waiting for floating point number"
-		err.Location = location
-		return 0.0, -1
+	s, l := ctx.findNumber(location, d.floatRe, d, d.floatSuffix, err)
+	if l < 0 {
+		return 0.0, l
 	}
 
-	r, e := strconv.ParseFloat(string(m), size)
+	r, e := strconv.ParseFloat(s, size)
 	if e != nil {
-		err.Message = "Invalid floating point number"
-		err.Location = location
+		numberError(e, "Floating point", location, err)
 		return 0.0, -1
 	}
 
-	return r, location + len(m)
+	return r, l
 }
 
 type intParser struct {
 	idHolder
 	terminal
+	// Dialect of numbers or nil for the default dialect
+	Dialect *numberDialect
 }
 
 type uintParser struct {
 	idHolder
 	terminal
+	Dialect *numberDialect
 }
 
 type floatParser struct {
 	idHolder
 	terminal
+	Dialect *numberDialect
 }
 
 func (par *intParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
@@ -667,7 +629,7 @@ func (par *intParser) ParseValue(ctx *parseContext, valueOf reflect.Value, locat
 		return location
 	}
 
-	r, l := ctx.parseInt64(location, uint(valueOf.Type().Bits()), err)
+	r, l := ctx.parseInt64(location, uint(valueOf.Type().Bits()), ctx.numberDialect(par.Dialect), err)
 	if l < 0 {
 		return l
 	}
@@ -686,7 +648,7 @@ func (par *intParser) IsLRPossible(parsers []parser) (possible bool, canParseEmp
 }
 
 func (par *uintParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
-	r, l := ctx.parseUint64(location, uint(valueOf.Type().Bits()), err)
+	r, l := ctx.parseUint64(location, uint(valueOf.Type().Bits()), ctx.numberDialect(par.Dialect), err)
 	if l < 0 {
 		return l
 	}
@@ -705,7 +667,7 @@ func (par *uintParser) IsLRPossible(parsers []parser) (possible bool, canParseEm
 }
 
 func (par *floatParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
-	r, l := ctx.parseFloat(location, valueOf.Type().Bits(), err)
+	r, l := ctx.parseFloat(location, valueOf.Type().Bits(), ctx.numberDialect(par.Dialect), err)
 	if l < 0 {
 		return l
 	}
@@ -723,6 +685,137 @@ func (par *floatParser) IsLRPossible(parsers []parser) (possible bool, canParseE
 	return false, false
 }
 
+// Component of complex number: decimal or hexadecimal floating point number with optional underscores.
+const complexPart = `(0[xX][0-9a-fA-F_]*(\.[0-9a-fA-F_]*)?([pP][-+]?[0-9_]+)?|([0-9][0-9_]*(\.[0-9_]*)?|\.[0-9][0-9_]*)([eE][-+]?[0-9_]+)?)`
+
+var complexRegexp = regexp.MustCompile(`^(?P<first>[-+]?` + complexPart + `)((?P<second>[-+]` + complexPart + `)?i)?`)
+var complexFirst = complexRegexp.SubexpIndex("first")
+var complexSecond = complexRegexp.SubexpIndex("second")
+
+// Parse component of complex number. size is size of component in bits.
+func parseComplexPart(s string, size int) (float64, error) {
+	t := strings.TrimLeft(s, "+-")
+	if (strings.HasPrefix(t, "0x") || strings.HasPrefix(t, "0X")) && !strings.ContainsAny(t, "pP") {
+		// Hexadecimal integer: strconv requires exponent for hexadecimal mantissa
+		s += "p0"
+	}
+
+	return strconv.ParseFloat(s, size)
+}
+
+func (ctx *parseContext) parseComplex(location int, size int, err *Error) (complex128, int) {
+	m := complexRegexp.FindSubmatchIndex(ctx.str[location:])
+
+	if m == nil {
+		err.Message = "Waiting for complex number"
+		err.Location = location
+		return 0, -1
+	}
+
+	str := ctx.str[location:]
+	first := string(str[m[2*complexFirst]:m[2*complexFirst+1]])
+	var re, im float64
+	var e error
+	if m[2*complexSecond] >= 0 { // re+imi
+		re, e = parseComplexPart(first, size/2)
+		if e == nil {
+			im, e = parseComplexPart(string(str[m[2*complexSecond]:m[2*complexSecond+1]]), size/2)
+		}
+	} else if m[1] > m[2*complexFirst+1] { // imi
+		im, e = parseComplexPart(first, size/2)
+	} else {
+		re, e = parseComplexPart(first, size/2)
+	}
+
+	if e != nil {
+		numberError(e, "Floating point", location, err)
+		return 0, -1
+	}
+
+	return complex(re, im), location + m[1]
+}
+
+// Complex number parser. If Pair is set number is parsed as (re, im) tuple.
+type complexParser struct {
+	idHolder
+	terminal
+	Pair bool
+}
+
+func (par *complexParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	size := valueOf.Type().Bits()
+	if !par.Pair {
+		r, l := ctx.parseComplex(location, size, err)
+		if l < 0 {
+			return l
+		}
+
+		valueOf.SetComplex(r)
+		return l
+	}
+
+	if !strAt(ctx.str, location, "(") {
+		err.Message = "Waiting for '('"
+		err.Location = location
+		return -1
+	}
+
+	re, l := ctx.parseFloat(ctx.skipWS(location+1), size/2, _numberDialects["go"], err)
+	if l < 0 {
+		return l
+	}
+
+	l = ctx.skipWS(l)
+	if !strAt(ctx.str, l, ",") {
+		err.Message = "Waiting for ','"
+		err.Location = l
+		return -1
+	}
+
+	im, l := ctx.parseFloat(ctx.skipWS(l+1), size/2, _numberDialects["go"], err)
+	if l < 0 {
+		return l
+	}
+
+	l = ctx.skipWS(l)
+	if !strAt(ctx.str, l, ")") {
+		err.Message = "Waiting for ')'"
+		err.Location = l
+		return -1
+	}
+
+	valueOf.SetComplex(complex(re, im))
+	return l + 1
+}
+
+func (par *complexParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	c := valueOf.Complex()
+	size := valueOf.Type().Bits() / 2
+
+	var buf []byte
+	if par.Pair {
+		buf = append(buf, '(')
+		buf = strconv.AppendFloat(buf, real(c), 'e', -1, size)
+		buf = append(buf, ", "...)
+		buf = strconv.AppendFloat(buf, imag(c), 'e', -1, size)
+		buf = append(buf, ')')
+	} else {
+		buf = strconv.AppendFloat(buf, real(c), 'e', -1, size)
+		if !math.Signbit(imag(c)) {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendFloat(buf, imag(c), 'e', -1, size)
+		buf = append(buf, 'i')
+	}
+
+	_, err := out.Write(buf)
+	return err
+}
+
+func (par *complexParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, false
+}
+
 // This parser only saves location
 type locationParser struct {
 	idHolder
@@ -748,7 +841,15 @@ type field struct {
 	Parse parser
 	Flags uint
 	Set   string
+	Check string
 	Type  reflect.Type
+	// Index of field to save delimiters into (if fieldDelimiters flag is set)
+	Delimiters int
+	// Index of field referenced by `match` or `until` tag (if fieldBackref flag is set)
+	Ref int
+	// Precedence and associativity of FirstOf alternative (if fieldPrec flag is set)
+	Prec  int
+	Assoc Assoc
 }
 
 func (par field) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
@@ -761,11 +862,30 @@ func (par field) ParseValue(ctx *parseContext, valueOf reflect.Value, location i
 		f = valueOf.Field(par.Index)
 	}
 
+	if (par.Flags & fieldInline) != 0 {
+		return par.parseInline(ctx, f, location, err)
+	}
+
 	if !f.CanSet() {
 		panic(fmt.Sprintf("Can't set field '%v.%s'", valueOf.Type(), par.Name))
 	}
 
-	l = ctx.parse(f, par.Parse, location, err)
+	state := ctx.snapshot()
+	if (par.Flags & fieldDelimiters) != 0 {
+		// Delimiters are saved into another field so we can't use packrat table here:
+		l = par.Parse.(listParser).parseList(ctx, f, valueOf.Field(par.Delimiters), ctx.skipWS(location), err)
+	} else if (par.Flags & fieldBackref) != 0 {
+		// Value depends on another field so we can't use packrat table here too:
+		l = par.Parse.(*backrefParser).parseRef(ctx, f, valueOf.Field(par.Ref).String(), ctx.skipWS(location), err)
+	} else {
+		l = ctx.parse(f, par.Parse, location, err)
+	}
+
+	if (par.Flags & (fieldNotAny | fieldFollowedBy)) != 0 {
+		// Predicates must not change the state
+		ctx.restore(state)
+	}
+
 	if (par.Flags & fieldNotAny) != 0 {
 		if l >= 0 {
 			err.Message = fmt.Sprintf("Unexpected input: %v", par.Parse)
@@ -786,31 +906,121 @@ func (par field) ParseValue(ctx *parseContext, valueOf reflect.Value, location i
 			return l
 		}
 
+		start := ctx.skipWS(location)
+		if par.Check != "" && !par.check(ctx, valueOf, f, start, err) {
+			ctx.restore(state)
+			return -1
+		}
+
 		if par.Set != "" {
-			method := valueOf.MethodByName(par.Set)
-			if !method.IsValid() && valueOf.CanAddr() {
-				method = valueOf.Addr().MethodByName(par.Set)
+			method := fieldMethod(valueOf, par.Set, f, methodType(f, false, _errorType),
+				methodType(f, true, _stateType, _errorType))
+			res := method.Call(ctx.methodArgs(method, f))
+			if len(res) == 2 && res[1].IsNil() {
+				ctx.setState(res[0].Interface())
+			} else if !res[len(res)-1].IsNil() {
+				e := res[len(res)-1].Interface().(error)
+				err.Location = start
+				err.Message = fmt.Sprintf("Set failed: %v", e)
+				err.Err = &SetError{Method: par.Set, Field: par.Name, Start: start, End: l, Err: e}
+				ctx.restore(state)
+				return -1
 			}
+		}
 
-			if !method.IsValid() {
-				panic(fmt.Sprintf("Can't find `%s' method", par.Set))
-			}
+		ctx.end = l
+		return ctx.skipWS(l)
+	}
+}
 
-			mtp := method.Type()
-			if mtp.NumIn() != 1 || mtp.NumOut() != 1 || mtp.In(0) != f.Type() || mtp.Out(0).Name() != "error" {
-				panic(fmt.Sprintf("Invalid method `%s' signature. Waiting for func (%v) error", par.Set, par.Parse))
-			}
+var _errorType = reflect.TypeOf((*error)(nil)).Elem()
+var _boolType = reflect.TypeOf(false)
 
-			resv := method.Call([]reflect.Value{f})[0]
-			if !resv.IsNil() {
-				err.Message = fmt.Sprintf("Set failed: %v", resv.Interface())
-				err.Location = l
-				return -l
-			}
+// Type of user state argument and result of methods
+var _stateType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// Type of `set` or `check` method: func (T) results or func (T, interface{}) results if state is true.
+func methodType(f reflect.Value, state bool, results ...reflect.Type) reflect.Type {
+	in := []reflect.Type{f.Type()}
+	if state {
+		in = append(in, _stateType)
+	}
+
+	return reflect.FuncOf(in, results, false)
+}
+
+// Find method of the structure for `set` or `check` tag. Method must have one of signatures.
+func fieldMethod(valueOf reflect.Value, name string, f reflect.Value, signatures ...reflect.Type) reflect.Value {
+	method := valueOf.MethodByName(name)
+	if !method.IsValid() && valueOf.CanAddr() {
+		method = valueOf.Addr().MethodByName(name)
+	}
+
+	if !method.IsValid() {
+		panic(fmt.Sprintf("Can't find `%s' method", name))
+	}
+
+	expected := make([]string, len(signatures))
+	for i, sig := range signatures {
+		if method.Type() == sig {
+			return method
 		}
+		expected[i] = sig.String()
+	}
 
-		return ctx.skipWS(l)
+	panic(fmt.Sprintf("Invalid method `%s' signature. Waiting for %s", name, strings.Join(expected, " or ")))
+}
+
+// Arguments of `set` or `check` method: value of the field and user state if method has second argument.
+func (ctx *parseContext) methodArgs(method reflect.Value, f reflect.Value) []reflect.Value {
+	if method.Type().NumIn() == 1 {
+		return []reflect.Value{f}
+	}
+
+	state := ctx.state()
+	return []reflect.Value{f, reflect.ValueOf(&state).Elem()}
+}
+
+// Call method of `check` tag. Returns false if parsed value is rejected.
+func (par field) check(ctx *parseContext, valueOf reflect.Value, f reflect.Value, start int, err *Error) bool {
+	method := fieldMethod(valueOf, par.Check, f, methodType(f, false, _boolType), methodType(f, false, _errorType),
+		methodType(f, true, _boolType), methodType(f, true, _errorType))
+	res := method.Call(ctx.methodArgs(method, f))[0]
+	if res.Kind() == reflect.Bool {
+		if res.Bool() {
+			return true
+		}
+
+		err.Message = fmt.Sprintf("Check `%s' failed for %s", par.Check, par.Name)
+	} else {
+		if res.IsNil() {
+			return true
+		}
+
+		err.Message = fmt.Sprintf("Check `%s' failed: %v", par.Check, res.Interface())
 	}
+
+	err.Location = start
+	return false
+}
+
+// Parse fields of embedded structure as fields of the parent. Embedded pointer is optional group of fields.
+func (par field) parseInline(ctx *parseContext, f reflect.Value, location int, err *Error) int {
+	if par.Type.Kind() != reflect.Ptr {
+		return par.Parse.ParseValue(ctx, f, location, err)
+	}
+
+	state := ctx.snapshot()
+	v := reflect.New(par.Type.Elem())
+	l := par.Parse.ParseValue(ctx, v.Elem(), location, err)
+	if l < 0 {
+		ctx.restore(state)
+		f.Set(reflect.Zero(par.Type))
+		return location
+	}
+
+	f.Set(v)
+	return l
 }
 
 func (par field) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
@@ -819,6 +1029,10 @@ func (par field) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bo
 		return
 	}
 
+	if (par.Flags&fieldInline) != 0 && par.Type.Kind() == reflect.Ptr {
+		canParseEmpty = true
+	}
+
 	if (par.Flags & (fieldNotAny | fieldFollowedBy)) != 0 {
 		canParseEmpty = true
 	}
@@ -831,6 +1045,27 @@ func (par field) WriteValue(out io.Writer, valueOf reflect.Value) error {
 		return nil
 	}
 
+	if (par.Flags & fieldInline) != 0 {
+		f := valueOf.Field(par.Index)
+		if par.Type.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				return nil
+			}
+			f = f.Elem()
+		}
+
+		return par.Parse.WriteValue(out, f)
+	}
+
+	if (par.Flags & fieldBackref) != 0 {
+		var f reflect.Value
+		if par.Index >= 0 {
+			f = valueOf.Field(par.Index)
+		}
+
+		return par.Parse.(*backrefParser).writeRef(out, f, valueOf.Field(par.Ref).String())
+	}
+
 	if par.Index < 0 { // We can not out this value in all cases but if it was literal we can do it
 		// TODO: Check if it is string and output only in case it is literal
 		p := par.Parse
@@ -851,12 +1086,19 @@ func (par field) WriteValue(out io.Writer, valueOf reflect.Value) error {
 			case *literalParser:
 				_, err := out.Write([]byte(tp.Literal))
 				return err
+			case *newlineParser, *eolParser, *indentParser, *dedentParser:
+				// Markers don't have a value
+				return tp.WriteValue(out, v)
 			default:
 				return errors.New("Could not out anonymous field if it is not literal")
 			}
 		}
 	} else {
 		f := valueOf.Field(par.Index)
+		if (par.Flags & fieldDelimiters) != 0 {
+			return par.Parse.(listParser).writeList(out, f, valueOf.Field(par.Delimiters))
+		}
+
 		return par.Parse.WriteValue(out, f)
 	}
 }
@@ -864,6 +1106,10 @@ func (par field) WriteValue(out io.Writer, valueOf reflect.Value) error {
 const (
 	fieldNotAny     uint = 1
 	fieldFollowedBy uint = 2
+	fieldDelimiters uint = 4
+	fieldPrec       uint = 8
+	fieldInline     uint = 16
+	fieldBackref    uint = 32
 )
 
 type sequenceParser struct {
@@ -873,8 +1119,16 @@ type sequenceParser struct {
 }
 
 func (par *sequenceParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
-	for _, f := range par.Fields {
+	plan := ctx.plan
+	for i, f := range par.Fields {
+		if plan.rule != 0 && i > 0 && i < len(par.Fields)-1 {
+			// Only the first and the last fields are operands of alternative with precedence, other fields
+			// (e.g. arguments of call in parentheses) are parsed without the plan:
+			ctx.plan = precPlan{}
+		}
+
 		location = f.ParseValue(ctx, valueOf, location, err)
+		ctx.plan = plan
 		if location < 0 {
 			return location
 		}
@@ -916,14 +1170,37 @@ type firstOfParser struct {
 	idHolder
 	nonTerminal
 	Fields []field
+	// Sorted precedence levels of alternatives
+	Levels []int
 }
 
 func (par *firstOfParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
-	maxError := Error{ctx.str, location - 1, "No choices in first of"}
+	maxError := Error{Str: ctx.str, Location: location - 1, Message: "No choices in first of"}
 	var l int
 
+	level := ctx.level
+	plan := ctx.plan
 	for _, f := range par.Fields {
+		if len(par.Levels) > 0 {
+			if level < len(par.Levels) {
+				// Only alternatives of current precedence level:
+				if (f.Flags&fieldPrec) == 0 || f.Prec != par.Levels[level] {
+					continue
+				}
+
+				ctx.plan = precPlan{rule: par.ID(), location: location, left: level, right: level + 1}
+				if f.Assoc == AssocRight {
+					ctx.plan.left, ctx.plan.right = level+1, level
+				} else if f.Assoc == AssocNone {
+					ctx.plan.left = level + 1
+				}
+			} else if (f.Flags & fieldPrec) != 0 {
+				continue
+			}
+		}
+
 		l = f.ParseValue(ctx, valueOf, location, err)
+		ctx.plan = plan
 		if l >= 0 {
 			valueOf.FieldByName("FirstOf").FieldByName("Field").SetString(f.Name)
 			return l
@@ -933,17 +1210,36 @@ func (par *firstOfParser) ParseValue(ctx *parseContext, valueOf reflect.Value, l
 			maxError.Location = err.Location
 			maxError.Str = err.Str
 			maxError.Message = err.Message
+			maxError.Err = err.Err
+		}
+	}
+
+	if len(par.Levels) > 0 && level < len(par.Levels) {
+		// Try expression of the next precedence level:
+		ctx.plan = precPlan{rule: par.ID(), location: location, left: level + 1, right: level + 1}
+		l = ctx.parse(valueOf, par, location, err)
+		ctx.plan = plan
+		if l >= 0 {
+			return l
+		}
+
+		if err.Location > maxError.Location {
+			maxError.Location = err.Location
+			maxError.Str = err.Str
+			maxError.Message = err.Message
+			maxError.Err = err.Err
 		}
 	}
 
 	err.Message = maxError.Message
 	err.Location = maxError.Location
+	err.Err = maxError.Err
 	return -1
 }
 
 func (par *firstOfParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
 	var err error
-	nm := valueOf.Field(0).Field(0).String()
+	nm := valueOf.FieldByName("FirstOf").Field(0).String()
 
 	if nm == "" {
 		return errors.New("Field is not selected in FirstOf")
@@ -978,63 +1274,205 @@ func (par *firstOfParser) IsLRPossible(parsers []parser) (possible bool, canPars
 	return
 }
 
+// Parser of interface type. Registered alternatives are tried in order.
+type interfaceParser struct {
+	idHolder
+	nonTerminal
+	Types   []reflect.Type
+	Parsers []parser
+}
+
+func (par *interfaceParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	maxError := Error{Str: ctx.str, Location: location - 1, Message: "No alternatives of interface"}
+
+	for i, p := range par.Parsers {
+		v := reflect.New(par.Types[i]).Elem()
+		l := ctx.parse(v, p, location, err)
+		if l >= 0 {
+			valueOf.Set(v)
+			return l
+		}
+
+		if err.Location > maxError.Location {
+			maxError.Location = err.Location
+			maxError.Message = err.Message
+			maxError.Err = err.Err
+		}
+	}
+
+	err.Message = maxError.Message
+	err.Location = maxError.Location
+	err.Err = maxError.Err
+	return -1
+}
+
+func (par *interfaceParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	if valueOf.IsNil() {
+		return fmt.Errorf("Value of %v is nil", valueOf.Type())
+	}
+
+	tp := valueOf.Elem().Type()
+	for i, t := range par.Types {
+		if t == tp {
+			return par.Parsers[i].WriteValue(out, valueOf.Elem())
+		}
+	}
+
+	return fmt.Errorf("Type %v is not registered alternative of %v", tp, valueOf.Type())
+}
+
+func (par *interfaceParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	for _, p := range par.Parsers {
+		pos, can := isLRPossible(p, parsers)
+		if pos {
+			return true, can
+		}
+
+		if can {
+			canParseEmpty = true
+		}
+	}
+
+	return false, canParseEmpty
+}
+
 // Slice parser
+// Delimiter of list members.
+type listDelimiter struct {
+	// Delimiter parser or nil if there is no delimiter
+	Delimiter parser
+	// Type of parsed delimiter values
+	DelimType reflect.Type
+	// Literal written between members if parsed delimiters are not saved (see `delimiters` tag)
+	DelimWrite string
+}
+
+// Write delimiter placed before i-th member. If delims is valid delimiter is taken from it.
+func (d *listDelimiter) writeDelimiter(out io.Writer, delims reflect.Value, i int) error {
+	if delims.IsValid() {
+		return d.Delimiter.WriteValue(out, delims.Index(i-1))
+	}
+
+	_, err := out.Write([]byte(d.DelimWrite))
+	return err
+}
+
+// Parser of lists or maps that could save parsed delimiters into another field.
+type listParser interface {
+	parser
+	parseList(ctx *parseContext, valueOf reflect.Value, delims reflect.Value, location int, err *Error) int
+	writeList(out io.Writer, valueOf reflect.Value, delims reflect.Value) error
+	delimiter() *listDelimiter
+}
+
+func (d *listDelimiter) delimiter() *listDelimiter {
+	return d
+}
+
 type sliceParser struct {
 	idHolder
 	nonTerminal
-	Parser    parser
-	Delimiter string
-	Min       int
+	Parser parser
+	listDelimiter
+	Min int
 }
 
 func (par *sliceParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	return par.parseList(ctx, valueOf, reflect.Value{}, location, err)
+}
+
+// Parse list and save parsed delimiters into delims if it is valid.
+func (par *sliceParser) parseList(ctx *parseContext, valueOf reflect.Value, delims reflect.Value, location int, err *Error) int {
 	var v reflect.Value
 
 	valueOf.SetLen(0)
+	if delims.IsValid() {
+		delims.SetLen(0)
+	}
+
 	tp := valueOf.Type().Elem()
+	// End of the last parsed element and state after it:
+	end := location
+	state := ctx.snapshot()
 	for {
 		v = reflect.New(tp).Elem()
 		var nl int
 
 		nl = ctx.parse(v, par.Parser, location, err)
 		if nl < 0 {
+			// Delimiter after the last element is not parsed:
+			ctx.restore(state)
+			if delims.IsValid() && valueOf.Len() > 0 {
+				delims.SetLen(valueOf.Len() - 1)
+			}
+
 			if valueOf.Len() >= par.Min {
-				return location
+				return end
 			}
 
 			return nl
 		}
 
-		if nl <= location {
-			panic("Invalid grammar: 0-length member of ZeroOrMore")
+		if nl <= location && par.Delimiter == nil {
+			// Element matches empty string, so it would be matched forever: the list ends here. Empty elements
+			// are added only if they are required by the minimal length of the list.
+			if valueOf.Len() >= par.Min {
+				ctx.restore(state)
+			}
+			for valueOf.Len() < par.Min {
+				valueOf.Set(reflect.Append(valueOf, v))
+			}
+
+			return location
 		}
 
+		start := location
 		location = nl
+		end = nl
+		state = ctx.snapshot()
 		valueOf.Set(reflect.Append(valueOf, v))
 
-		if len(par.Delimiter) > 0 {
-			nl = ctx.skipWS(location)
-
-			if strAt(ctx.str, nl, par.Delimiter) {
-				location = ctx.skipWS(nl + len(par.Delimiter))
-			} else {
+		if par.Delimiter != nil {
+			d := reflect.New(par.DelimType).Elem()
+			nl = ctx.parse(d, par.Delimiter, location, err)
+			if nl < 0 {
 				// Here we've got at least one parsed member, so it could not be an error.
-				return nl
+				return end
+			}
+
+			if ctx.skipWS(nl) <= start {
+				// Both element and delimiter are empty: the list ends here.
+				ctx.restore(state)
+				return end
+			}
+
+			if delims.IsValid() {
+				delims.Set(reflect.Append(delims, d))
 			}
+			location = ctx.skipWS(nl)
 		}
 	}
 }
 
 func (par *sliceParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	return par.writeList(out, valueOf, reflect.Value{})
+}
+
+// Write list. If delims is valid delimiters are taken from it.
+func (par *sliceParser) writeList(out io.Writer, valueOf reflect.Value, delims reflect.Value) error {
 	var err error
 
 	if valueOf.Len() < par.Min {
 		return errors.New("Not enough members in slice")
 	}
 
+	if delims.IsValid() && valueOf.Len() > 0 && delims.Len() != valueOf.Len()-1 {
+		return fmt.Errorf("Invalid count of delimiters: %d for %d members", delims.Len(), valueOf.Len())
+	}
+
 	for i := 0; i < valueOf.Len(); i++ {
-		if i > 0 && len(par.Delimiter) > 0 {
-			_, err = out.Write([]byte(par.Delimiter))
+		if i > 0 && par.Delimiter != nil {
+			err = par.writeDelimiter(out, delims, i)
 			if err != nil {
 				return err
 			}
@@ -1059,6 +1497,218 @@ func (par *sliceParser) IsLRPossible(parsers []parser) (possible bool, canParseE
 	return
 }
 
+// Policy of handling of duplicate keys in maps
+const (
+	mapDupError = iota
+	mapDupLast
+	mapDupFirst
+)
+
+// Map parser. Map is parsed as list of KEY KV VALUE entries.
+type mapParser struct {
+	idHolder
+	nonTerminal
+	Key   parser
+	Value parser
+	// Key/value separator
+	KV parser
+	listDelimiter
+	Min int
+	Dup int
+}
+
+// Parse one entry of the map. Returns location after entry.
+func (par *mapParser) parseEntry(ctx *parseContext, key, value reflect.Value, location int, err *Error) int {
+	l := ctx.parse(key, par.Key, location, err)
+	if l < 0 {
+		return l
+	}
+
+	l = ctx.parse(reflect.New(_stringType).Elem(), par.KV, l, err)
+	if l < 0 {
+		return l
+	}
+
+	return ctx.parse(value, par.Value, l, err)
+}
+
+func (par *mapParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	return par.parseList(ctx, valueOf, reflect.Value{}, location, err)
+}
+
+// Parse map and save parsed delimiters into delims if it is valid.
+func (par *mapParser) parseList(ctx *parseContext, valueOf reflect.Value, delims reflect.Value, location int, err *Error) int {
+	tp := valueOf.Type()
+	valueOf.Set(reflect.MakeMap(tp))
+	if delims.IsValid() {
+		delims.SetLen(0)
+	}
+
+	// End of the last parsed entry, state after it and count of parsed entries:
+	end := location
+	state := ctx.snapshot()
+	count := 0
+	for {
+		key := reflect.New(tp.Key()).Elem()
+		value := reflect.New(tp.Elem()).Elem()
+
+		nl := par.parseEntry(ctx, key, value, location, err)
+		if nl < 0 {
+			ctx.restore(state)
+			if delims.IsValid() && count > 0 {
+				// Delimiter after the last entry is not parsed:
+				delims.SetLen(count - 1)
+			}
+
+			if valueOf.Len() >= par.Min {
+				return end
+			}
+
+			return nl
+		}
+
+		if nl <= location {
+			// Empty entry would be parsed forever, so the map ends here:
+			ctx.restore(state)
+			if delims.IsValid() && count > 0 {
+				delims.SetLen(count - 1)
+			}
+
+			if valueOf.Len() >= par.Min {
+				return end
+			}
+
+			err.Location = location
+			err.Message = "Empty entry of map"
+			return -1
+		}
+
+		if valueOf.MapIndex(key).IsValid() {
+			switch par.Dup {
+			case mapDupError:
+				err.Location = ctx.skipWS(location)
+				err.Message = fmt.Sprintf("Duplicate key %v", key)
+				return -1
+			case mapDupLast:
+				valueOf.SetMapIndex(key, value)
+			}
+		} else {
+			valueOf.SetMapIndex(key, value)
+		}
+
+		location = nl
+		end = nl
+		state = ctx.snapshot()
+		count++
+
+		if par.Delimiter != nil {
+			d := reflect.New(par.DelimType).Elem()
+			nl = ctx.parse(d, par.Delimiter, location, err)
+			if nl < 0 {
+				return end
+			}
+
+			if delims.IsValid() {
+				delims.Set(reflect.Append(delims, d))
+			}
+			location = ctx.skipWS(nl)
+		}
+	}
+}
+
+// Get keys of the map in deterministic order: natural order for numbers and strings and order of encoded
+// keys for other types.
+func (par *mapParser) sortedKeys(valueOf reflect.Value) ([]reflect.Value, error) {
+	keys := valueOf.MapKeys()
+
+	switch valueOf.Type().Key().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Uint() < keys[j].Uint() })
+	case reflect.Float32, reflect.Float64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Float() < keys[j].Float() })
+	case reflect.String:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	default:
+		encoded := make(map[int]string, len(keys))
+		idx := make([]int, len(keys))
+		for i, k := range keys {
+			var buf bytes.Buffer
+			err := par.Key.WriteValue(&buf, k)
+			if err != nil {
+				return nil, err
+			}
+			encoded[i] = buf.String()
+			idx[i] = i
+		}
+
+		sort.SliceStable(idx, func(i, j int) bool { return encoded[idx[i]] < encoded[idx[j]] })
+		res := make([]reflect.Value, len(keys))
+		for i, k := range idx {
+			res[i] = keys[k]
+		}
+		keys = res
+	}
+
+	return keys, nil
+}
+
+func (par *mapParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	return par.writeList(out, valueOf, reflect.Value{})
+}
+
+// Write map entries sorted by keys. If delims is valid delimiters are taken from it in order.
+func (par *mapParser) writeList(out io.Writer, valueOf reflect.Value, delims reflect.Value) error {
+	if valueOf.Len() < par.Min {
+		return errors.New("Not enough members in map")
+	}
+
+	if delims.IsValid() && valueOf.Len() > 0 && delims.Len() != valueOf.Len()-1 {
+		return fmt.Errorf("Invalid count of delimiters: %d for %d entries", delims.Len(), valueOf.Len())
+	}
+
+	keys, err := par.sortedKeys(valueOf)
+	if err != nil {
+		return err
+	}
+
+	for i, k := range keys {
+		if i > 0 && par.Delimiter != nil {
+			err = par.writeDelimiter(out, delims, i)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = par.Key.WriteValue(out, k)
+		if err != nil {
+			return err
+		}
+
+		err = par.KV.WriteValue(out, reflect.New(_stringType).Elem())
+		if err != nil {
+			return err
+		}
+
+		err = par.Value.WriteValue(out, valueOf.MapIndex(k))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (par *mapParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	possible, canParseEmpty = isLRPossible(par.Key, parsers)
+	if par.Min == 0 {
+		canParseEmpty = true
+	}
+
+	return
+}
+
 // Ptr
 type ptrParser struct {
 	idHolder
@@ -1071,6 +1721,7 @@ func (par *ptrParser) ParseValue(ctx *parseContext, valueOf reflect.Value, locat
 	nl := ctx.parse(v.Elem(), par.Parser, location, err)
 	if nl < 0 {
 		if par.Optional {
+			valueOf.Set(reflect.Zero(valueOf.Type()))
 			return location
 		}
 		return nl
@@ -1106,10 +1757,54 @@ func (par *ptrParser) IsLRPossible(parsers []parser) (possible bool, canParseEmp
 	return
 }
 
+// Check if parser is ptrParser or proxy for it.
+func isPtrParser(p parser) bool {
+	if proxy, ok := p.(*proxyParser); ok {
+		p = proxy.p
+	}
+
+	_, ok := p.(*ptrParser)
+	return ok
+}
+
 func (par *ptrParser) IsTerm() bool {
 	return par.Parser.IsTerm()
 }
 
+// Key of packrat table for parsing without whitespace skipping
+const skipKeyLexical = -1
+
+// Parser that changes whitespace skipping function while parsing the value.
+// Whitespace before the value is skipped using outer function.
+type skipParser struct {
+	idHolder
+	nonTerminal
+	Parser parser
+	// Skip function or nil if whitespace must not be skipped
+	Skip func(str []byte, loc int) int
+	// Key for packrat table
+	Key int
+}
+
+func (par *skipParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	skip, key := ctx.skip, ctx.skipKey
+	ctx.skip, ctx.skipKey = par.Skip, par.Key
+
+	l := ctx.parse(valueOf, par.Parser, location, err)
+
+	ctx.skip, ctx.skipKey = skip, key
+
+	return l
+}
+
+func (par *skipParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	return par.Parser.WriteValue(out, valueOf)
+}
+
+func (par *skipParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return isLRPossible(par.Parser, parsers)
+}
+
 // Parser
 type parserParser struct {
 	idHolder
@@ -1117,23 +1812,35 @@ type parserParser struct {
 }
 
 func (par *parserParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
-	var v Parser
+	var v interface{}
 	if par.ptr {
-		v = valueOf.Addr().Interface().(Parser)
+		v = valueOf.Addr().Interface()
 	} else {
 		if valueOf.Kind() == reflect.Ptr {
 			valueOf = reflect.New(valueOf.Type().Elem())
 		}
-		v = valueOf.Interface().(Parser)
+		v = valueOf.Interface()
+	}
+
+	var l int
+	var e error
+	if sp, ok := v.(StatefulParser); ok {
+		var state interface{}
+		l, state, e = sp.ParseValue(ctx.str, location, ctx.state())
+		if e == nil {
+			ctx.setState(state)
+		}
+	} else {
+		l, e = v.(Parser).ParseValue(ctx.str, location)
 	}
 
-	l, e := v.ParseValue(ctx.str, location)
 	if e != nil {
 		switch ev := e.(type) {
 		case Error:
 			err.Location = ev.Location
 			err.Message = ev.Message
 			err.Str = ev.Str
+			err.Err = ev.Err
 			return -1
 		}
 		err.Location = location
@@ -1149,21 +1856,26 @@ func (par *parserParser) ParseValue(ctx *parseContext, valueOf reflect.Value, lo
 	return location
 }
 
+// Common part of Parser and StatefulParser
+type valueWriter interface {
+	WriteValue(out io.Writer) error
+}
+
 var errEmptyValue = errors.New("Trying to out nil value")
 
 func (par *parserParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
-	var v Parser
+	var v valueWriter
 	if par.ptr {
-		v = valueOf.Addr().Interface().(Parser)
+		v = valueOf.Addr().Interface().(valueWriter)
 	} else {
-		v = valueOf.Interface().(Parser)
+		v = valueOf.Interface().(valueWriter)
 	}
 
 	if valueOf.Kind() == reflect.Ptr && valueOf.IsNil() {
 		return errEmptyValue
 	}
 
-	return v.WriteValue(out)
+	return v.WriteValue(userWriter(out))
 }
 
 func (par *parserParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
@@ -0,0 +1,122 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Raw is wrapper that saves both parsed value and source text of the value. Text doesn't contain
+// whitespace (and comments) skipped after the value. Write outputs Text if it is not empty and Value otherwise.
+type Raw[T any] struct {
+	Value T
+	Text  string
+}
+
+func (Raw[T]) rawInfo() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+type rawValue interface {
+	rawInfo() reflect.Type
+}
+
+var _rawValueType = reflect.TypeOf((*rawValue)(nil)).Elem()
+
+// Parser that saves source text of string into string or []byte field (`parse:"raw"` tag).
+type rawParser struct {
+	idHolder
+	terminal
+	Parser parser
+}
+
+func compileRaw(typeOf reflect.Type, tag reflect.StructTag) (parser, error) {
+	if typeOf.Kind() != reflect.String && (typeOf.Kind() != reflect.Slice || typeOf.Elem().Kind() != reflect.Uint8) {
+		return nil, fmt.Errorf("Invalid type for `parse:\"raw\"': %v (waiting for string or []byte)", typeOf)
+	}
+
+	p, err := compileInternal(_stringType, tagWithout(tag, "parse"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawParser{Parser: p}, nil
+}
+
+func (par *rawParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	l := par.Parser.ParseValue(ctx, reflect.New(_stringType).Elem(), location, err)
+	if l < 0 {
+		return l
+	}
+
+	if valueOf.Kind() == reflect.String {
+		valueOf.SetString(string(ctx.str[location:l]))
+	} else {
+		valueOf.SetBytes(append([]byte(nil), ctx.str[location:l]...))
+	}
+
+	return l
+}
+
+func (par *rawParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	var err error
+	if valueOf.Kind() == reflect.String {
+		_, err = out.Write([]byte(valueOf.String()))
+	} else {
+		_, err = out.Write(valueOf.Bytes())
+	}
+
+	return err
+}
+
+func (par *rawParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return isLRPossible(par.Parser, parsers)
+}
+
+// Parser of Raw[T] values.
+type rawWrapperParser struct {
+	idHolder
+	nonTerminal
+	Parser parser
+}
+
+func compileRawWrapper(typeOf reflect.Type) (parser, error) {
+	valueType := reflect.Zero(typeOf).Interface().(rawValue).rawInfo()
+
+	p, err := compileInternal(valueType, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawWrapperParser{Parser: p}, nil
+}
+
+func (par *rawWrapperParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	ctx.end = -1
+	l := ctx.parse(valueOf.Field(0), par.Parser, location, err)
+	if l < 0 {
+		return l
+	}
+
+	// Exclude whitespace (and comments) skipped after the last field of the value:
+	end := l
+	if ctx.end >= location && ctx.end < l && ctx.skipWS(ctx.end) == l {
+		end = ctx.end
+	}
+	valueOf.Field(1).SetString(string(ctx.str[location:end]))
+
+	return l
+}
+
+func (par *rawWrapperParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	if text := valueOf.Field(1).String(); text != "" {
+		_, err := out.Write([]byte(text))
+		return err
+	}
+
+	return par.Parser.WriteValue(out, valueOf.Field(0))
+}
+
+func (par *rawWrapperParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return isLRPossible(par.Parser, parsers)
+}
@@ -0,0 +1,487 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// String literal dialects for `string` tag. Each dialect has parse function returning decoded string and
+// location after the literal and quote function encoding string for Write.
+type stringDialect struct {
+	parse func(ctx *parseContext, location int, err *Error) (string, int)
+	quote func(s string) string
+}
+
+var _stringDialects = map[string]*stringDialect{
+	"go":     {parse: (*parseContext).parseString, quote: strconv.Quote},
+	"json":   {parse: (*parseContext).parseJSONString, quote: quoteJSON},
+	"sql":    {parse: (*parseContext).parseSQLString, quote: quoteSQL},
+	"python": {parse: (*parseContext).parsePythonString, quote: quotePython},
+	"shell":  {parse: (*parseContext).parseShellString, quote: quoteShell},
+}
+
+// Get string dialect from `string` tag. Default dialect is Go.
+func compileStringDialect(tag reflect.StructTag) (*stringDialect, error) {
+	name := tag.Get("string")
+	if name == "" {
+		name = "go"
+	}
+
+	d, ok := _stringDialects[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown string dialect `%s'", name)
+	}
+
+	return d, nil
+}
+
+// Parse hexadecimal number of n digits at location.
+func (ctx *parseContext) parseHex(location int, n int, err *Error) (rune, int) {
+	if location+n > len(ctx.str) {
+		err.Location = location
+		err.Message = "Unexpected end of file in escape sequence"
+		return 0, -1
+	}
+
+	v, e := strconv.ParseUint(string(ctx.str[location:location+n]), 16, 32)
+	if e != nil {
+		err.Location = location
+		err.Message = "Illegal character in hex code"
+		return 0, -1
+	}
+
+	return rune(v), location + n
+}
+
+// Parse JSON string: "..." with \uXXXX escapes (and surrogate pairs).
+func (ctx *parseContext) parseJSONString(location int, err *Error) (string, int) {
+	if !strAt(ctx.str, location, `"`) {
+		err.Location = location
+		err.Message = "Waiting for JSON string"
+		return "", -1
+	}
+
+	var buf bytes.Buffer
+	for location++; location < len(ctx.str); {
+		c := ctx.str[location]
+		if c == '"' {
+			return buf.String(), location + 1
+		} else if c < 0x20 {
+			err.Location = location
+			err.Message = "Control character in JSON string"
+			return "", -1
+		} else if c != '\\' {
+			r, l := utf8.DecodeRune(ctx.str[location:])
+			if r == utf8.RuneError && l == 1 {
+				err.Location = location
+				err.Message = "Invalid UTF-8 character"
+				return "", -1
+			}
+
+			buf.Write(ctx.str[location : location+l])
+			location += l
+			continue
+		}
+
+		location++
+		if location >= len(ctx.str) {
+			break
+		}
+
+		c = ctx.str[location]
+		location++
+		switch c {
+		case '"', '\\', '/':
+			buf.WriteByte(c)
+		case 'b':
+			buf.WriteByte('\b')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'u':
+			r, l := ctx.parseHex(location, 4, err)
+			if l < 0 {
+				return "", l
+			}
+
+			if utf16.IsSurrogate(r) {
+				var r2 rune = -1
+				if strAt(ctx.str, l, `\u`) {
+					r2, l = ctx.parseHex(l+2, 4, err)
+					if l < 0 {
+						return "", l
+					}
+				}
+
+				r = utf16.DecodeRune(r, r2)
+				if r == utf8.RuneError {
+					err.Location = location
+					err.Message = "Invalid surrogate pair"
+					return "", -1
+				}
+			}
+
+			buf.WriteRune(r)
+			location = l
+		default:
+			err.Location = location - 1
+			err.Message = "Invalid escaped char"
+			return "", -1
+		}
+	}
+
+	err.Location = location
+	err.Message = "Unexpected end of file in JSON string"
+	return "", -1
+}
+
+func quoteJSON(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+
+	return buf.String()
+}
+
+// Parse SQL string: '...' where quote is escaped by doubling.
+func (ctx *parseContext) parseSQLString(location int, err *Error) (string, int) {
+	if !strAt(ctx.str, location, "'") {
+		err.Location = location
+		err.Message = "Waiting for SQL string"
+		return "", -1
+	}
+
+	var buf bytes.Buffer
+	for location++; location < len(ctx.str); location++ {
+		if ctx.str[location] == '\'' {
+			if !strAt(ctx.str, location+1, "'") {
+				return buf.String(), location + 1
+			}
+			location++
+		}
+
+		buf.WriteByte(ctx.str[location])
+	}
+
+	err.Location = location
+	err.Message = "Unexpected end of file in SQL string"
+	return "", -1
+}
+
+func quoteSQL(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Parse Python string literal: optional prefix (r, b, u, rb, br in any case) and single, double or triple quotes.
+func (ctx *parseContext) parsePythonString(location int, err *Error) (string, int) {
+	start := location
+	n := 0
+	for n < 2 && location+n < len(ctx.str) && strings.IndexByte("rRbBuU", ctx.str[location+n]) >= 0 {
+		n++
+	}
+
+	prefix := strings.ToLower(string(ctx.str[location : location+n]))
+	switch prefix {
+	case "", "r", "u", "b", "rb", "br":
+	default:
+		err.Location = start
+		err.Message = "Waiting for Python string"
+		return "", -1
+	}
+
+	raw := strings.Contains(prefix, "r")
+	isBytes := strings.Contains(prefix, "b")
+	location += n
+
+	var quote string
+	if strAt(ctx.str, location, `"""`) || strAt(ctx.str, location, "'''") {
+		quote = string(ctx.str[location : location+3])
+	} else if strAt(ctx.str, location, `"`) || strAt(ctx.str, location, "'") {
+		quote = string(ctx.str[location : location+1])
+	} else {
+		err.Location = start
+		err.Message = "Waiting for Python string"
+		return "", -1
+	}
+
+	var buf bytes.Buffer
+	for location += len(quote); location < len(ctx.str); {
+		if strAt(ctx.str, location, quote) {
+			return buf.String(), location + len(quote)
+		}
+
+		c := ctx.str[location]
+		if c == '\n' && len(quote) == 1 {
+			break
+		}
+
+		if c != '\\' || location+1 >= len(ctx.str) {
+			buf.WriteByte(c)
+			location++
+			continue
+		}
+
+		c = ctx.str[location+1]
+		if raw {
+			// Backslash escapes quotes but is kept in the string:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+			location += 2
+			continue
+		}
+
+		location += 2
+		switch c {
+		case '\n':
+			// Line continuation
+		case '\\', '\'', '"':
+			buf.WriteByte(c)
+		case 'a':
+			buf.WriteByte('\a')
+		case 'b':
+			buf.WriteByte('\b')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'v':
+			buf.WriteByte('\v')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			r := rune(c - '0')
+			for i := 0; i < 2 && location < len(ctx.str) && ctx.str[location] >= '0' && ctx.str[location] <= '7'; i++ {
+				r = r*8 + rune(ctx.str[location]-'0')
+				location++
+			}
+			writePythonChar(&buf, r, isBytes)
+		case 'x', 'u', 'U':
+			digits := 2
+			if c == 'u' {
+				digits = 4
+			} else if c == 'U' {
+				digits = 8
+			}
+
+			if c != 'x' && isBytes {
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+				break
+			}
+
+			r, l := ctx.parseHex(location, digits, err)
+			if l < 0 {
+				return "", l
+			}
+
+			if !utf8.ValidRune(r) {
+				err.Location = location
+				err.Message = "Invalid rune"
+				return "", -1
+			}
+
+			writePythonChar(&buf, r, isBytes)
+			location = l
+		default:
+			// Unknown escape sequences are kept
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		}
+	}
+
+	err.Location = location
+	err.Message = "Unterminated Python string"
+	return "", -1
+}
+
+// Write character of Python string. In bytes literals codes are bytes.
+func writePythonChar(buf *bytes.Buffer, r rune, isBytes bool) {
+	if isBytes {
+		buf.WriteByte(byte(r))
+	} else {
+		buf.WriteRune(r)
+	}
+}
+
+// Quote string as Python literal. Strings that are not valid UTF-8 are written as bytes literals (b'...').
+func quotePython(s string) string {
+	quote := byte('\'')
+	if strings.Contains(s, "'") && !strings.Contains(s, `"`) {
+		quote = '"'
+	}
+
+	var buf strings.Builder
+	if !utf8.ValidString(s) {
+		// Bytes literal could contain only ASCII characters:
+		buf.WriteByte('b')
+		buf.WriteByte(quote)
+		for i := 0; i < len(s); i++ {
+			if s[i] >= 0x80 {
+				fmt.Fprintf(&buf, `\x%02x`, s[i])
+			} else {
+				writePythonQuoted(&buf, rune(s[i]), quote)
+			}
+		}
+		buf.WriteByte(quote)
+
+		return buf.String()
+	}
+
+	buf.WriteByte(quote)
+	for _, r := range s {
+		writePythonQuoted(&buf, r, quote)
+	}
+	buf.WriteByte(quote)
+
+	return buf.String()
+}
+
+// Write character of Python string literal escaping it if needed.
+func writePythonQuoted(buf *strings.Builder, r rune, quote byte) {
+	switch r {
+	case '\\':
+		buf.WriteString(`\\`)
+	case '\n':
+		buf.WriteString(`\n`)
+	case '\r':
+		buf.WriteString(`\r`)
+	case '\t':
+		buf.WriteString(`\t`)
+	default:
+		if r == rune(quote) {
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		} else if r < 0x20 || r == 0x7f {
+			fmt.Fprintf(buf, `\x%02x`, r)
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// Check if character ends unquoted shell word.
+func isShellMeta(c byte) bool {
+	return strings.IndexByte(" \t\r\n|&;<>()", c) >= 0
+}
+
+// Parse shell word: concatenation of unquoted characters, backslash escapes, '...' and "..." strings.
+func (ctx *parseContext) parseShellString(location int, err *Error) (string, int) {
+	start := location
+	var buf bytes.Buffer
+	for location < len(ctx.str) && !isShellMeta(ctx.str[location]) {
+		c := ctx.str[location]
+		switch c {
+		case '\\':
+			location++
+			if location >= len(ctx.str) {
+				err.Location = location
+				err.Message = "Unexpected end of file in escape sequence"
+				return "", -1
+			}
+
+			if ctx.str[location] != '\n' { // Line continuation is removed
+				buf.WriteByte(ctx.str[location])
+			}
+			location++
+
+		case '\'':
+			end := bytes.IndexByte(ctx.str[location+1:], '\'')
+			if end < 0 {
+				err.Location = location
+				err.Message = "Unterminated single quoted string"
+				return "", -1
+			}
+
+			buf.Write(ctx.str[location+1 : location+1+end])
+			location += end + 2
+
+		case '"':
+			location++
+			for location < len(ctx.str) && ctx.str[location] != '"' {
+				if ctx.str[location] == '\\' && location+1 < len(ctx.str) && strings.IndexByte("$`\"\\\n", ctx.str[location+1]) >= 0 {
+					if ctx.str[location+1] != '\n' {
+						buf.WriteByte(ctx.str[location+1])
+					}
+					location += 2
+				} else {
+					buf.WriteByte(ctx.str[location])
+					location++
+				}
+			}
+
+			if location >= len(ctx.str) {
+				err.Location = location
+				err.Message = "Unterminated double quoted string"
+				return "", -1
+			}
+			location++
+
+		default:
+			buf.WriteByte(c)
+			location++
+		}
+	}
+
+	if location == start {
+		err.Location = location
+		err.Message = "Waiting for shell word"
+		return "", -1
+	}
+
+	return buf.String(), location
+}
+
+// Check if string could be written as shell word without quotes.
+func isShellSafe(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_@%+=:,./-", c) >= 0) {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+func quoteShell(s string) string {
+	if isShellSafe(s) {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,85 @@
+package parse
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var _textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var _textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// Parser of types implementing encoding.TextUnmarshaler. Text of the value is matched by string parser compiled from
+// `regexp`, `chars` or `unicode` tag and then decoded with UnmarshalText. Write uses MarshalText.
+type textParser struct {
+	idHolder
+	terminal
+	Parser parser
+}
+
+// Compile parser for TextUnmarshaler. Returns nil if type doesn't implement the interface or there is no tag
+// defining text of the value.
+func compileText(typeOf reflect.Type, tag reflect.StructTag) (parser, error) {
+	if typeOf.Kind() == reflect.Ptr || !reflect.PtrTo(typeOf).Implements(_textUnmarshalerType) {
+		return nil, nil
+	}
+
+	_, hasRegexp := tag.Lookup("regexp")
+	_, hasChars := tag.Lookup("chars")
+	_, hasUnicode := tag.Lookup("unicode")
+	if !hasRegexp && !hasChars && !hasUnicode {
+		return nil, nil
+	}
+
+	p, err := compileInternal(_stringType, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &textParser{Parser: p}, nil
+}
+
+func (par *textParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	s := reflect.New(_stringType).Elem()
+	l := par.Parser.ParseValue(ctx, s, location, err)
+	if l < 0 {
+		return l
+	}
+
+	v := reflect.New(valueOf.Type())
+	if e := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s.String())); e != nil {
+		err.Location = location
+		err.Message = fmt.Sprintf("Invalid %v: %v", valueOf.Type(), e)
+		return -1
+	}
+
+	valueOf.Set(v.Elem())
+
+	return l
+}
+
+func (par *textParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	var m encoding.TextMarshaler
+	if valueOf.Type().Implements(_textMarshalerType) {
+		m = valueOf.Interface().(encoding.TextMarshaler)
+	} else if reflect.PtrTo(valueOf.Type()).Implements(_textMarshalerType) {
+		v := reflect.New(valueOf.Type())
+		v.Elem().Set(valueOf)
+		m = v.Interface().(encoding.TextMarshaler)
+	} else {
+		return fmt.Errorf("Type %v doesn't implement encoding.TextMarshaler", valueOf.Type())
+	}
+
+	text, err := m.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(text)
+	return err
+}
+
+func (par *textParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return isLRPossible(par.Parser, parsers)
+}
@@ -0,0 +1,212 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var _timeType = reflect.TypeOf(time.Time{})
+var _durationType = reflect.TypeOf(time.Duration(0))
+
+// Named layouts that could be used in `layout` tag.
+var _timeLayouts = map[string]string{
+	"ansic":       time.ANSIC,
+	"unixdate":    time.UnixDate,
+	"rubydate":    time.RubyDate,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"rfc850":      time.RFC850,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"kitchen":     time.Kitchen,
+	"stamp":       time.Stamp,
+	"stampmilli":  time.StampMilli,
+	"stampmicro":  time.StampMicro,
+	"stampnano":   time.StampNano,
+	"datetime":    "2006-01-02 15:04:05",
+	"dateonly":    "2006-01-02",
+	"timeonly":    "15:04:05",
+}
+
+// Regular expressions for elements of time layouts. Longer elements are before their prefixes. Numbers without
+// leading zero could have one or two digits and seconds could be followed by fraction as in time.Parse.
+var _timeLayoutElements = []struct {
+	std string
+	rx  string
+}{
+	{"January", `[A-Za-z]+`},
+	{"Jan", `[A-Za-z]{3}`},
+	{"Monday", `[A-Za-z]+`},
+	{"Mon", `[A-Za-z]{3}`},
+	{"MST", `(?:[A-Za-z]{3,5}(?:[-+]\d{1,2})?|[-+]\d{2}(?:\d{2})?)`},
+	{"2006", `\d{4}`},
+	{"__2", ` {0,2}\d{1,3}`},
+	{"_2006", `_\d{4}`},
+	{"_2", ` ?\d{1,2}`},
+	{"002", `\d{3}`},
+	{"01", `\d{2}`},
+	{"02", `\d{2}`},
+	{"03", `\d{2}`},
+	{"04", `\d{2}`},
+	{"05", `\d{2}(?:[.,]\d+)?`},
+	{"06", `\d{2}`},
+	{"15", `\d{1,2}`},
+	{"1", `\d{1,2}`},
+	{"2", `\d{1,2}`},
+	{"3", `\d{1,2}`},
+	{"4", `\d{1,2}`},
+	{"5", `\d{1,2}(?:[.,]\d+)?`},
+	{"PM", `[AaPp][Mm]`},
+	{"pm", `[AaPp][Mm]`},
+	{"Z07:00:00", `(?:Z|[-+]\d{2}:\d{2}:\d{2})`},
+	{"-07:00:00", `[-+]\d{2}:\d{2}:\d{2}`},
+	{"Z070000", `(?:Z|[-+]\d{6})`},
+	{"-070000", `[-+]\d{6}`},
+	{"Z07:00", `(?:Z|[-+]\d{2}:\d{2})`},
+	{"-07:00", `[-+]\d{2}:\d{2}`},
+	{"Z0700", `(?:Z|[-+]\d{4})`},
+	{"-0700", `[-+]\d{4}`},
+	{"Z07", `(?:Z|[-+]\d{2})`},
+	{"-07", `[-+]\d{2}`},
+}
+
+// Make regular expression matching text that could be parsed with the layout. It is used to find the text before
+// calling time.Parse.
+func timeLayoutRegexp(layout string) (*regexp.Regexp, error) {
+	var rx strings.Builder
+	rx.WriteString("^")
+	for layout != "" {
+		// Fraction of second: .000 or .999 (or with comma) not followed by a digit:
+		if layout[0] == '.' || layout[0] == ',' {
+			n := 1
+			for n < len(layout) && layout[n] == layout[1] && (layout[n] == '0' || layout[n] == '9') {
+				n++
+			}
+			if n > 1 && (n == len(layout) || layout[n] < '0' || layout[n] > '9') {
+				if layout[1] == '0' {
+					fmt.Fprintf(&rx, `[.,]\d{%d}`, n-1)
+				} else {
+					rx.WriteString(`(?:[.,]\d+)?`)
+				}
+				layout = layout[n:]
+				continue
+			}
+		}
+
+		found := false
+		for _, e := range _timeLayoutElements {
+			if strings.HasPrefix(layout, e.std) {
+				rx.WriteString(e.rx)
+				layout = layout[len(e.std):]
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			_, n := utf8.DecodeRuneInString(layout)
+			rx.WriteString(regexp.QuoteMeta(layout[:n]))
+			layout = layout[n:]
+		}
+	}
+
+	res, err := regexp.Compile(rx.String())
+	if err != nil {
+		return nil, err
+	}
+	res.Longest()
+
+	return res, nil
+}
+
+// Parser of time.Time values formatted with layout.
+type timeParser struct {
+	idHolder
+	terminal
+	Layout string
+	rx     *regexp.Regexp
+}
+
+func compileTime(tag reflect.StructTag) (parser, error) {
+	layout := tag.Get("layout")
+	if layout == "" {
+		layout = time.RFC3339
+	} else if l, ok := _timeLayouts[strings.ToLower(layout)]; ok {
+		layout = l
+	}
+
+	rx, err := timeLayoutRegexp(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &timeParser{Layout: layout, rx: rx}, nil
+}
+
+func (par *timeParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	m := par.rx.Find(ctx.str[location:])
+	if m != nil {
+		t, e := time.Parse(par.Layout, string(m))
+		if e == nil {
+			valueOf.Set(reflect.ValueOf(t))
+			return location + len(m)
+		}
+	}
+
+	err.Location = location
+	err.Message = fmt.Sprintf("Waiting for time in format `%s'", par.Layout)
+	return -1
+}
+
+func (par *timeParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	_, err := out.Write([]byte(valueOf.Interface().(time.Time).Format(par.Layout)))
+	return err
+}
+
+func (par *timeParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, false
+}
+
+var durationRegexp = regexp.MustCompile(`^[-+]?(((\d+(\.\d*)?|\.\d+)(ns|us|µs|μs|ms|s|m|h))+|0)`)
+
+// Parser of time.Duration values in Go syntax (1h30m, 1.5s, -20ms).
+type durationParser struct {
+	idHolder
+	terminal
+}
+
+func (par *durationParser) ParseValue(ctx *parseContext, valueOf reflect.Value, location int, err *Error) int {
+	m := durationRegexp.Find(ctx.str[location:])
+	if m == nil {
+		err.Location = location
+		err.Message = "Waiting for duration"
+		return -1
+	}
+
+	d, e := time.ParseDuration(string(m))
+	if e != nil {
+		err.Location = location
+		err.Message = "Invalid duration"
+		return -1
+	}
+
+	valueOf.SetInt(int64(d))
+
+	return location + len(m)
+}
+
+func (par *durationParser) WriteValue(out io.Writer, valueOf reflect.Value) error {
+	_, err := out.Write([]byte(time.Duration(valueOf.Int()).String()))
+	return err
+}
+
+func (par *durationParser) IsLRPossible(parsers []parser) (possible bool, canParseEmpty bool) {
+	return false, false
+}
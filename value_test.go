@@ -2,7 +2,12 @@ package parse
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"reflect"
 	"testing"
+	"time"
 )
 
 type sTst struct {
@@ -138,6 +143,70 @@ func TestBool(t *testing.T) {
 
 }
 
+type boolSettings struct {
+	Debug  bool `bool:"yes/no,on/off,1/0"`
+	Strict bool `bool:"TRUE/FALSE"`
+}
+
+func TestBoolSpellings(t *testing.T) {
+	var s boolSettings
+	src := "on FALSE"
+	l, err := Parse(&s, []byte(src), nil)
+	if err != nil || l != len(src) || !s.Debug || s.Strict {
+		t.Errorf("Invalid result (%d): %v %v", l, s, err)
+	}
+
+	res, err := Append(nil, s)
+	if err != nil || string(res) != "yesFALSE" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	for _, src := range []string{"onion TRUE", "0 true", "no TRUEs"} {
+		_, err = Parse(&s, []byte(src), nil)
+		if err == nil {
+			t.Errorf("Invalid booleans were accepted: %s", src)
+		}
+	}
+
+	var b bool
+	for _, src := range []string{"yes", "Y"} {
+		_, err = Parse(&b, []byte(src), &Options{SkipWhite: SkipSpaces, BoolSpellings: "yes/no, Y/N"})
+		if err != nil || !b {
+			t.Errorf("Invalid default spellings: %s %v %v", src, b, err)
+		}
+	}
+
+	_, err = Parse(&b, []byte("true"), &Options{BoolSpellings: "yes"})
+	if err == nil {
+		t.Errorf("Invalid spellings were accepted")
+	}
+
+	_, err = Parse(&b, []byte("trueish"), nil)
+	if err == nil {
+		t.Errorf("Boolean value followed by identifier was accepted")
+	}
+
+	// Default spellings are used by WriteWithOptions:
+	opts := &Options{SkipWhite: SkipSpaces, BoolSpellings: "yes/no, Y/N"}
+	for _, v := range []bool{true, false} {
+		res, err = AppendWithOptions(nil, v, opts)
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		b = !v
+		_, err = Parse(&b, res, opts)
+		if err != nil || b != v {
+			t.Errorf("Invalid round trip of %v (%s): %v %v", v, string(res), b, err)
+		}
+	}
+
+	res, err = AppendWithOptions(nil, boolSettings{Debug: true}, opts)
+	if err != nil || string(res) != "yesFALSE" {
+		t.Errorf("Invalid output with options: %s %v", string(res), err)
+	}
+}
+
 type fTst struct {
 	input  string
 	result float64
@@ -178,3 +247,521 @@ func TestFloat(t *testing.T) {
 		}
 	}
 }
+
+type cTst struct {
+	input  string
+	result complex128
+	ok     bool
+}
+
+var cTests = []cTst{
+	{"1+2i", 1 + 2i, true},
+	{"3i", 3i, true},
+	{"-0.5e3i", -0.5e3i, true},
+	{"1.5", 1.5, true},
+	{"-1.5e2-.5i", -1.5e2 - .5i, true},
+	{"1e400+1i", 0, false},
+	{"i", 0, false},
+	{"1_000+0.5i", 1000 + 0.5i, true},
+	{"0x10-0x1p-2i", 16 - 0.25i, true},
+	{"0x_Fi", 15i, true},
+	{"1__0i", 0, false},
+}
+
+type complexPair struct {
+	C complex64 `complex:"pair"`
+}
+
+func TestComplex(t *testing.T) {
+	for _, tst := range cTests {
+		var c complex128
+		l, err := Parse(&c, []byte(tst.input), nil)
+		if tst.ok != (err == nil) {
+			t.Errorf("Invalid parsing result for %s: %v", tst.input, err)
+		} else if tst.ok && (c != tst.result || l != len(tst.input)) {
+			t.Errorf("Invalid value of %s (%d): %v", tst.input, l, c)
+		}
+	}
+
+	res, err := Append(nil, complex128(1-2i))
+	if err != nil || string(res) != "1e+00-2e+00i" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	var p complexPair
+	_, err = Parse(&p, []byte("( 1.5, -2 )"), nil)
+	if err != nil || p.C != 1.5-2i {
+		t.Errorf("Invalid pair: %v %v", p.C, err)
+	}
+
+	res, err = Append(nil, p)
+	if err != nil || string(res) != "(1.5e+00, -2e+00)" {
+		t.Errorf("Invalid pair output: %s %v", string(res), err)
+	}
+
+	_, err = Parse(&p, []byte("(1e40, 1)"), nil)
+	if err == nil {
+		t.Errorf("complex64 overflow was accepted")
+	}
+
+	var c64 complex64
+	_, err = Parse(&c64, []byte("1e39+2i"), nil)
+	if e, ok := err.(Error); !ok || e.Message != "Floating point overflow" {
+		t.Errorf("Invalid complex64 overflow error: %v", err)
+	}
+}
+
+type bigValues struct {
+	I *big.Int
+	F *big.Float `precision:"200"`
+	R *big.Rat
+	H *big.Int
+}
+
+func TestBig(t *testing.T) {
+	var v bigValues
+	src := "-123456789012345678901234567890 3.14159265358979323846264338327950288 -6/8 0xdead_beef_dead_beef_dead_beef"
+	l, err := Parse(&v, []byte(src), nil)
+	if err != nil || l != len(src) {
+		t.Fatalf("Parse failed (%d): %v", l, err)
+	}
+
+	if v.I.String() != "-123456789012345678901234567890" || v.F.Prec() != 200 || v.R.RatString() != "-3/4" ||
+		v.H.Text(16) != "deadbeefdeadbeefdeadbeef" {
+		t.Errorf("Invalid values: %v %v %v %v", v.I, v.F, v.R, v.H)
+	}
+
+	for _, x := range []interface{}{v.I, v.R} {
+		res, err := Append(nil, x)
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		y := reflect.New(reflect.TypeOf(x).Elem())
+		_, err = Parse(y.Interface(), res, nil)
+		if err != nil || y.MethodByName("Cmp").Call([]reflect.Value{reflect.ValueOf(x)})[0].Int() != 0 {
+			t.Errorf("Invalid output: %s %v", string(res), err)
+		}
+	}
+
+	res, err := Append(nil, v.R)
+	if err != nil || string(res) != "-3/4" {
+		t.Errorf("Invalid rational output: %s %v", string(res), err)
+	}
+
+	res, err = Append(nil, v.F)
+	if err != nil || string(res) != "3.14159265358979323846264338327950288" {
+		t.Errorf("Invalid float output: %s %v", string(res), err)
+	}
+
+	var r big.Rat
+	_, err = Parse(&r, []byte("1.25e-1"), nil)
+	if err != nil || r.RatString() != "1/8" {
+		t.Errorf("Invalid decimal rational: %v %v", r.RatString(), err)
+	}
+
+	_, err = Parse(&r, []byte("1/0"), nil)
+	if err == nil {
+		t.Errorf("Zero denominator was accepted")
+	}
+}
+
+type timeValues struct {
+	Start   time.Time `layout:"rfc3339"`
+	Day     time.Time `layout:"02/01/2006"`
+	Timeout time.Duration
+}
+
+type stampValue struct {
+	Stamp   time.Time `layout:"stamp"`
+	Kitchen time.Time `layout:"kitchen"`
+	_       string    `literal:","`
+	Month   time.Time `layout:"January"`
+	_       string    `literal:";"`
+}
+
+func TestTime(t *testing.T) {
+	var v timeValues
+	src := "2024-03-05T10:20:30+02:00 17/08/2023 1h30m"
+	l, err := Parse(&v, []byte(src), nil)
+	if err != nil || l != len(src) {
+		t.Fatalf("Parse failed (%d): %v", l, err)
+	}
+
+	if v.Start.Hour() != 10 || v.Start.Minute() != 20 || v.Day.Month() != time.August || v.Day.Day() != 17 ||
+		v.Timeout != 90*time.Minute {
+		t.Errorf("Invalid values: %v", v)
+	}
+
+	res, err := Append(nil, v)
+	if err != nil || string(res) != "2024-03-05T10:20:30+02:0017/08/20231h30m0s" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	_, err = Parse(&v, []byte("2024-13-05T10:20:30Z 17/08/2023 1h"), nil)
+	if err == nil {
+		t.Errorf("Invalid time was accepted")
+	}
+
+	var st stampValue
+	l, err = Parse(&st, []byte("Mar  5 10:20:30.125 12:30PM, March; rest of the text"), nil)
+	if err != nil || l != 36 || st.Stamp.Day() != 5 || st.Stamp.Nanosecond() != 125000000 || st.Kitchen.Hour() != 12 ||
+		st.Month.Month() != time.March {
+		t.Errorf("Invalid time before text (%d): %v %v", l, st, err)
+	}
+
+	var d time.Duration
+	_, err = Parse(&d, []byte("-1.5s"), nil)
+	if err != nil || d != -1500*time.Millisecond {
+		t.Errorf("Invalid duration: %v %v", d, err)
+	}
+}
+
+type numTst struct {
+	dialect string
+	input   string
+	result  float64
+	ok      bool
+}
+
+type numInt8 struct {
+	V int8
+}
+
+type numC struct {
+	I int64   `number:"c"`
+	U uint32  `number:"c"`
+	F float64 `number:"c"`
+}
+
+func TestNumberDialects(t *testing.T) {
+	ints := []numTst{
+		{"go", "0b1010", 10, true},
+		{"go", "0o17", 15, true},
+		{"go", "017", 15, true},
+		{"go", "1_000_000", 1000000, true},
+		{"go", "-0x_1F", -31, true},
+		{"go", "-9223372036854775808", -9223372036854775808, true},
+		{"go", "9223372036854775808", 0, false},
+		{"json", "007", 0, false},
+		{"json", "-0", 0, true},
+		{"json", "0x10", 0, false},
+		{"plain", "007", 7, true},
+		{"plain", "+12", 12, true},
+	}
+
+	for _, tst := range ints {
+		var v int64
+		l, err := Parse(&v, []byte(tst.input), &Options{SkipWhite: SkipSpaces, NumberDialect: tst.dialect})
+		ok := err == nil && l == len(tst.input)
+		if ok != tst.ok || (ok && v != int64(tst.result)) {
+			t.Errorf("Invalid result for %s number %s: %d %v", tst.dialect, tst.input, v, err)
+		}
+	}
+
+	uints := []numTst{
+		{"plain", "+5", 5, true},
+		{"go", "+5", 0, false},
+		{"c", "10u", 10, true},
+		{"c", "10lu", 10, true},
+		{"c", "10ULL", 10, true},
+		{"c", "10llU", 10, true},
+		{"c", "10LuLu", 0, false},
+		{"c", "10uu", 0, false},
+		{"c", "10lll", 0, false},
+	}
+
+	for _, tst := range uints {
+		var v uint64
+		l, err := Parse(&v, []byte(tst.input), &Options{SkipWhite: SkipSpaces, NumberDialect: tst.dialect})
+		ok := err == nil && l == len(tst.input)
+		if ok != tst.ok || (ok && v != uint64(tst.result)) {
+			t.Errorf("Invalid result for %s number %s: %d %v", tst.dialect, tst.input, v, err)
+		}
+	}
+
+	floats := []numTst{
+		{"go", "1.", 1, true},
+		{"go", "0x1p-2", 0.25, true},
+		{"go", "1_000.5", 1000.5, true},
+		{"json", "1.5e3", 1500, true},
+		{"json", "01.5", 0, false},
+		{"json", "1.", 0, false},
+		{"plain", "-Inf", math.Inf(-1), true},
+		{"go", "Inf", 0, false},
+	}
+
+	for _, tst := range floats {
+		var v float64
+		l, err := Parse(&v, []byte(tst.input), &Options{SkipWhite: SkipSpaces, NumberDialect: tst.dialect})
+		ok := err == nil && l == len(tst.input)
+		if ok != tst.ok || (ok && v != tst.result) {
+			t.Errorf("Invalid result for %s number %s: %v %v", tst.dialect, tst.input, v, err)
+		}
+	}
+
+	var nan float64
+	_, err := Parse(&nan, []byte("NaN"), &Options{SkipWhite: SkipSpaces, NumberDialect: "plain"})
+	if err != nil || !math.IsNaN(nan) {
+		t.Errorf("NaN was not parsed: %v", err)
+	}
+
+	var i8 numInt8
+	_, err = Parse(&i8, []byte("200"), nil)
+	if err == nil {
+		t.Errorf("int8 overflow was accepted")
+	}
+
+	_, err = Parse(&i8, []byte("-128"), nil)
+	if err != nil || i8.V != -128 {
+		t.Errorf("Invalid int8 value: %d %v", i8.V, err)
+	}
+
+	var c numC
+	src := "-10L 0x10UL 1.5f"
+	l, err := Parse(&c, []byte(src), &Options{SkipWhite: SkipSpaces, NumberDialect: "json"})
+	if err != nil || l != len(src) || c.I != -10 || c.U != 16 || c.F != 1.5 {
+		t.Errorf("Invalid C numbers (%d): %v %v", l, c, err)
+	}
+
+	_, err = Parse(&i8, []byte("1"), &Options{NumberDialect: "cobol"})
+	if err == nil {
+		t.Errorf("Unknown dialect was accepted")
+	}
+}
+
+type strDialectTst struct {
+	dialect string
+	input   string
+	result  string
+	output  string
+}
+
+func TestStringDialects(t *testing.T) {
+	tests := []strDialectTst{
+		{"json", `"a\"b\\c\/\né😀"`, "a\"b\\c/\né😀", `"a\"b\\c/\né😀"`},
+		{"json", `"\u0001"`, "\x01", `"\u0001"`},
+		{"sql", `'it''s'`, "it's", `'it''s'`},
+		{"python", `'a\'b\x41\n'`, "a'bA\n", `"a'bA\n"`},
+		{"python", `r'a\n\''`, `a\n\'`, `"a\\n\\'"`},
+		{"python", `"""multi
+line"""`, "multi\nline", `'multi\nline'`},
+		{"python", `b'\xff'`, "\xff", `b'\xff'`},
+		{"python", `B"a'\xc3\n"`, "a'\xc3\n", `b"a'\xc3\n"`},
+		{"python", `b'\xc3\xa9'`, "é", `'é'`},
+		{"shell", `abc'd e'"f\"g"\ h`, "abcd ef\"g h", `'abcd ef"g h'`},
+		{"shell", `simple-word`, "simple-word", `simple-word`},
+		{"shell", `"it's"`, "it's", `'it'\''s'`},
+	}
+
+	for _, tst := range tests {
+		v := reflect.New(reflect.StructOf([]reflect.StructField{{
+			Name: "S",
+			Type: reflect.TypeOf(""),
+			Tag:  reflect.StructTag(fmt.Sprintf("string:%q", tst.dialect)),
+		}}))
+
+		l, err := Parse(v.Interface(), []byte(tst.input), nil)
+		s := v.Elem().Field(0).String()
+		if err != nil || l != len(tst.input) || s != tst.result {
+			t.Errorf("Invalid %s string %s (%d): %q %v", tst.dialect, tst.input, l, s, err)
+			continue
+		}
+
+		res, err := Append(nil, v.Elem().Interface())
+		if err != nil || string(res) != tst.output {
+			t.Errorf("Invalid output of %s string %q: %s %v", tst.dialect, s, string(res), err)
+			continue
+		}
+
+		// Output must be parsed to the same value:
+		_, err = Parse(v.Interface(), res, nil)
+		if err != nil || v.Elem().Field(0).String() != tst.result {
+			t.Errorf("Output of %s string %q was parsed as %q: %v", tst.dialect, s, v.Elem().Field(0).String(), err)
+		}
+	}
+
+	for _, tst := range []strDialectTst{
+		{"json", "\"a\nb\"", "", ""},
+		{"json", `"\x41"`, "", ""},
+		{"sql", `'abc`, "", ""},
+		{"python", "'a\nb'", "", ""},
+		{"python", `ur'a'`, "", ""},
+		{"shell", `'abc`, "", ""},
+	} {
+		v := reflect.New(reflect.StructOf([]reflect.StructField{{
+			Name: "S",
+			Type: reflect.TypeOf(""),
+			Tag:  reflect.StructTag(fmt.Sprintf("string:%q", tst.dialect)),
+		}}))
+
+		_, err := Parse(v.Interface(), []byte(tst.input), nil)
+		if err == nil {
+			t.Errorf("Invalid %s string was accepted: %s", tst.dialect, tst.input)
+		}
+	}
+}
+
+type enumOp int
+
+const (
+	enumAdd enumOp = iota + 1
+	enumAddAssign
+	enumInc
+	enumSub
+)
+
+func (enumOp) Enum() map[string]enumOp {
+	return map[string]enumOp{"+": enumAdd, "+=": enumAddAssign, "++": enumInc, "-": enumSub, "minus": enumSub}
+}
+
+type enumColor string
+
+// Named integer type with constants declared with iota.
+type enumKind int
+
+const (
+	enumKindAdd enumKind = iota
+	enumKindSub
+	enumKindMul
+)
+
+// Enum method with other signature is not an enumeration table
+func (enumKind) Enum() []string {
+	return nil
+}
+
+type enumTest struct {
+	Ops    []enumOp
+	Level  int       `enum:"low,medium,high=10"`
+	Mode   uint8     `enum:"r=4,w=2,x=1"`
+	Color  enumColor `enum:"red,green,blue=#0000ff"`
+	Assign string    `enum:"+=,-==sub"`
+}
+
+type enumKinds struct {
+	A, B, C, D enumKind `enum:"+=Add,-=Sub,*=Mul,plus=Add"`
+}
+
+type enumAliases struct {
+	A, B, C enumKind `enum:"+=Add,plus=Add,-=Sub,*=Mul"`
+}
+
+type enumClash struct {
+	A enumKind `enum:"+=Add,-=Sub,*=1"`
+}
+
+func TestEnum(t *testing.T) {
+	var v enumTest
+	src := "+ += ++ minus - high w blue -="
+	_, err := Parse(&v, []byte(src), nil)
+	ops := []enumOp{enumAdd, enumAddAssign, enumInc, enumSub, enumSub}
+	if err != nil || !reflect.DeepEqual(v.Ops, ops) || v.Level != 10 || v.Mode != 2 || v.Color != "#0000ff" || v.Assign != "sub" {
+		t.Fatalf("Invalid result: %v %v", v, err)
+	}
+
+	res, err := Append(nil, &v)
+	if err != nil || string(res) != "++=++--highwblue-=" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	_, err = Parse(&v, []byte("+ minuses"), nil)
+	if err == nil {
+		t.Errorf("Literal was matched inside of identifier: %v", v)
+	}
+
+	_, err = Parse(&v, []byte("+ medium r green +="), nil)
+	if err != nil || v.Level != 1 || v.Mode != 4 || v.Color != "green" || v.Assign != "+=" {
+		t.Errorf("Invalid result: %v %v", v, err)
+	}
+
+	var k enumKinds
+	_, err = Parse(&k, []byte("* + - plus"), nil)
+	if err != nil || k != (enumKinds{enumKindMul, enumKindAdd, enumKindSub, enumKindAdd}) {
+		t.Errorf("Invalid symbolic values: %v %v", k, err)
+	}
+
+	res, err = Append(nil, &k)
+	if err != nil || string(res) != "*+-+" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	var a enumAliases
+	_, err = Parse(&a, []byte("- * plus"), nil)
+	if err != nil || a != (enumAliases{enumKindSub, enumKindMul, enumKindAdd}) {
+		t.Errorf("Invalid symbolic values with alias: %v %v", a, err)
+	}
+
+	var c enumClash
+	_, err = Parse(&c, []byte("*"), nil)
+	if err == nil {
+		t.Errorf("Numeric value equal to symbolic one was accepted: %v", c)
+	}
+
+	// Type with unrelated Enum method is parsed as integer:
+	var kind enumKind
+	_, err = Parse(&kind, []byte("2"), nil)
+	if err != nil || kind != enumKindMul {
+		t.Errorf("Invalid integer value: %v %v", kind, err)
+	}
+
+	v.Mode = 3
+	_, err = Append(nil, &v)
+	if err == nil {
+		t.Errorf("Value out of enumeration was written")
+	}
+}
+
+type textVersion struct {
+	Major, Minor int
+}
+
+func (v *textVersion) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "v%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+func (v textVersion) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("v%d.%d", v.Major, v.Minor)), nil
+}
+
+type textTest struct {
+	Version textVersion `regexp:"v[0-9]+\\.[0-9]+"`
+	Addr    netip.Addr  `chars:"0-9a-fA-F.:"`
+	Gateway *netip.Addr `regexp:"[0-9.]+" parse:"?"`
+	_       string      `literal:";"`
+}
+
+func TestText(t *testing.T) {
+	var v textTest
+	_, err := Parse(&v, []byte("v1.12 ::1 10.0.0.1;"), nil)
+	if err != nil || v.Version != (textVersion{1, 12}) || v.Addr != netip.MustParseAddr("::1") ||
+		v.Gateway == nil || *v.Gateway != netip.MustParseAddr("10.0.0.1") {
+		t.Fatalf("Invalid result: %v %v", v, err)
+	}
+
+	res, err := Append(nil, &v)
+	if err != nil || string(res) != "v1.12::110.0.0.1;" {
+		t.Errorf("Invalid output: %s %v", string(res), err)
+	}
+
+	_, err = Parse(&v, []byte("v2.0 127.0.0.1;"), nil)
+	if err != nil || v.Version.Major != 2 || v.Gateway != nil {
+		t.Errorf("Invalid result: %v %v", v, err)
+	}
+
+	_, err = Parse(&v, []byte("v2.0 127.0.0.300;"), nil)
+	if err == nil {
+		t.Errorf("Invalid address was accepted: %v", v)
+	}
+
+	// Big numbers and time are parsed by their own parsers:
+	var b struct {
+		N *big.Int `regexp:"[0-9]+"`
+		_ string   `literal:";"`
+	}
+	_, err = Parse(&b, []byte("0x1f;"), nil)
+	if err != nil || b.N == nil || b.N.Int64() != 31 {
+		t.Errorf("Invalid result: %v %v", b.N, err)
+	}
+}